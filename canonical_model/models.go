@@ -0,0 +1,63 @@
+package canonical_model
+
+import (
+	"time"
+
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/money"
+)
+
+type DependentDTO struct {
+	DependentId               string     `json:"dependent_id" bson:"dependent_id" rules:"required"`
+	EmployeeId                string     `json:"employee_id" bson:"employee_id" rules:"required"`
+	FirstName                 string     `json:"first_name" bson:"first_name" rules:"required"`
+	LastName                  string     `json:"last_name" bson:"last_name" rules:"required"`
+	DateOfBirth               *time.Time `json:"date_of_birth" bson:"date_of_birth" rules:"required,sensitive" validate:"range=1900-01-01..today"`
+	Sex                       string     `json:"sex" bson:"sex"`
+	Relationship              string     `json:"relationship" bson:"relationship" rules:"required"`
+	RelationshipEffectiveDate *time.Time `json:"relationship_effective_date" bson:"relationship_effective_date"`
+	Student                   *bool      `json:"student" bson:"student"`
+	OverAgeDisabled           *bool      `json:"over_age_disabled" bson:"over_age_disabled"`
+	TobaccoUser               *bool      `json:"tobacco_user" bson:"tobacco_user"`
+}
+
+type BenefitElectionDTO struct {
+	ElectionId    string     `json:"election_id" bson:"election_id" rules:"required"`
+	EmployeeId    string     `json:"employee_id" bson:"employee_id" rules:"required"`
+	BenefitType   string     `json:"benefit_type" bson:"benefit_type" rules:"required"`
+	CoverageLevel string     `json:"coverage_level" bson:"coverage_level"`
+	Status        State      `json:"status" bson:"status"`
+	EffectiveDate time.Time  `json:"effective_date" bson:"effective_date" rules:"required"`
+	EndDate       *time.Time `json:"end_date" bson:"end_date"`
+	DependentIds  []string   `json:"dependent_ids" bson:"dependent_ids"`
+}
+
+type PayrollDeductionDTO struct {
+	DeductionId   string       `json:"deduction_id" bson:"deduction_id" rules:"required"`
+	EmployeeId    string       `json:"employee_id" bson:"employee_id" rules:"required"`
+	DeductionCode string       `json:"deduction_code" bson:"deduction_code" rules:"required"`
+	Amount        money.Amount `json:"amount" bson:"amount" rules:"required"`
+	Frequency     string       `json:"frequency" bson:"frequency"`
+	PreTax        *bool        `json:"pre_tax" bson:"pre_tax"`
+	EffectiveDate time.Time    `json:"effective_date" bson:"effective_date" rules:"required"`
+	EndDate       *time.Time   `json:"end_date" bson:"end_date"`
+}
+
+type Model struct {
+	Entity      interface{}
+	IdField     string
+	Constraints model.Constraints
+}
+
+const DefaultModel = "employee"
+
+var Models = map[string]Model{
+	DefaultModel: {Entity: EmployeeDTO{}, IdField: "employee_id", Constraints: model.Constraints{
+		{Name: "hired_before_termination", Field: "date_of_hire", Operator: "<=", Other: "termination_date"},
+		{Name: "benefits_start_after_hire", Field: "benefits_start_date", Operator: ">=", Other: "date_of_hire"},
+		{Name: "dependent_younger_than_employee", Field: "dependents.+.date_of_birth", Operator: ">", Other: "date_of_birth"},
+	}},
+	"dependent":         {Entity: DependentDTO{}, IdField: "dependent_id"},
+	"benefit_election":  {Entity: BenefitElectionDTO{}, IdField: "election_id"},
+	"payroll_deduction": {Entity: PayrollDeductionDTO{}, IdField: "deduction_id"},
+}
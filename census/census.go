@@ -0,0 +1,267 @@
+package census
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+)
+
+var kinds = map[string]meta.Type{
+	"":         meta.String,
+	"string":   meta.String,
+	"bool":     meta.Bool,
+	"int":      meta.Int,
+	"float":    meta.Float,
+	"money":    meta.Money,
+	"date":     meta.Date,
+	"duration": meta.Duration,
+}
+
+const FormatExtension = ".format.json"
+
+type Format struct {
+	Dates   []string            `json:"dates"`
+	Inputs  map[string][]string `json:"inputs"`
+	Decimal string              `json:"decimal"`
+}
+
+var layoutReplacer = strings.NewReplacer("YYYY", "2006", "MM", "01", "DD", "02")
+
+func ReadFormat(path string) (Format, error) {
+	var format Format
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return format, nil
+	}
+	if err != nil {
+		return format, err
+	}
+	if err := json.Unmarshal(bytes, &format); err != nil {
+		return format, fmt.Errorf("%s: %v", path, err)
+	}
+	if format.Decimal != "" && format.Decimal != "." && format.Decimal != "," {
+		return format, fmt.Errorf("%s: decimal separator must be '.' or ',', not '%s'", path, format.Decimal)
+	}
+	format.Dates = layouts(format.Dates)
+	for name, formats := range format.Inputs {
+		format.Inputs[name] = layouts(formats)
+	}
+	return format, nil
+}
+
+func layouts(formats []string) []string {
+	result := make([]string, len(formats))
+	for i, format := range formats {
+		result[i] = layoutReplacer.Replace(format)
+	}
+	return result
+}
+
+func (f Format) DateFormats(name string) []string {
+	if formats, ok := f.Inputs[name]; ok {
+		return formats
+	}
+	if len(f.Dates) > 0 {
+		return f.Dates
+	}
+	return meta.DefaultDateFormats
+}
+
+func (f Format) Formats(name string) meta.Formats {
+	result := meta.Formats{Dates: f.DateFormats(name)}
+	if f.Decimal != "" {
+		result.Decimal = rune(f.Decimal[0])
+	}
+	return result
+}
+
+func (f Format) configured(name string) bool {
+	_, ok := f.Inputs[name]
+	return ok || len(f.Dates) > 0
+}
+
+type Record struct {
+	line   int
+	fields map[string]string
+	format Format
+}
+
+func NewRecord(line int, fields map[string]string) *Record {
+	return &Record{line: line, fields: fields}
+}
+
+func (r *Record) Line() int {
+	return r.line
+}
+
+func (r *Record) Formats(input string) meta.Formats {
+	return r.format.Formats(input)
+}
+
+func (r *Record) Field(name, kind string) (interface{}, error) {
+	value, ok := r.fields[name]
+	if !ok {
+		return nil, fmt.Errorf("input '%s' is missing in line %d", name, r.line)
+	}
+	return ConvertInput(name, kind, value, r.format.Formats(name))
+}
+
+func ConvertInput(name, kind, value string, formats meta.Formats) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+	kindType, ok := kinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown kind '%s' of input '%s'", kind, name)
+	}
+	result := formats.Convert(value, kindType)
+	if err, ok := result.(*meta.ConversionError); ok {
+		return nil, err.WithPrefix(fmt.Sprintf("input '%s': ", name))
+	}
+	if err, ok := result.(error); ok {
+		return nil, fmt.Errorf("input '%s': %v", name, err)
+	}
+	return result, nil
+}
+
+func (r *Record) Fields() map[string]string {
+	return r.fields
+}
+
+func Columns(records model.Records) model.Set {
+	result := model.Set{}
+	for _, record := range records {
+		if record, ok := record.(*Record); ok {
+			for name := range record.fields {
+				result[name] = struct{}{}
+			}
+		}
+	}
+	return result
+}
+
+func ReadFile(path string) (model.Records, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	format, err := ReadFormat(path + FormatExtension)
+	if err != nil {
+		return nil, err
+	}
+	records, err := ReadWithFormat(file, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return records, nil
+}
+
+func Read(reader io.Reader) (model.Records, error) {
+	return ReadWithFormat(reader, Format{})
+}
+
+func ReadWithFormat(reader io.Reader, format Format) (model.Records, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = InputName(header[i])
+	}
+	var result model.Records
+	for line := 2; ; line++ {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(row) {
+				fields[name] = strings.TrimSpace(row[i])
+			} else {
+				fields[name] = ""
+			}
+		}
+		result = append(result, &Record{line: line, fields: fields, format: format})
+	}
+}
+
+func InputName(header string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.TrimSpace(header)), "_"))
+}
+
+var numericDate = regexp.MustCompile(`^(\d{1,2})[/-](\d{1,2})[/-]\d{4}$`)
+
+func DateAmbiguities(records model.Records) (result []string) {
+	type evidence struct {
+		ambiguous, dayFirst, monthFirst string
+	}
+	columns := map[string]*evidence{}
+	for _, r := range records {
+		record, ok := r.(*Record)
+		if !ok {
+			continue
+		}
+		for name, value := range record.fields {
+			if record.format.configured(name) {
+				continue
+			}
+			match := numericDate.FindStringSubmatch(value)
+			if match == nil {
+				continue
+			}
+			column, ok := columns[name]
+			if !ok {
+				column = &evidence{}
+				columns[name] = column
+			}
+			first, _ := strconv.Atoi(match[1])
+			second, _ := strconv.Atoi(match[2])
+			switch {
+			case first > 12 && column.dayFirst == "":
+				column.dayFirst = value
+			case second > 12 && column.monthFirst == "":
+				column.monthFirst = value
+			case first <= 12 && second <= 12 && first != second && column.ambiguous == "":
+				column.ambiguous = value
+			}
+		}
+	}
+
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		column := columns[name]
+		switch {
+		case column.dayFirst != "" && column.monthFirst != "":
+			result = append(result, fmt.Sprintf("input '%s' mixes day-first ('%s') and month-first ('%s') dates", name, column.dayFirst, column.monthFirst))
+		case column.dayFirst != "":
+			result = append(result, fmt.Sprintf("input '%s' has day-first dates such as '%s'; configure its date format as DD/MM/YYYY", name, column.dayFirst))
+		case column.monthFirst == "" && column.ambiguous != "":
+			result = append(result, fmt.Sprintf("input '%s' has dates such as '%s' that could be MM/DD/YYYY or DD/MM/YYYY", name, column.ambiguous))
+		}
+	}
+	return result
+}
@@ -0,0 +1,138 @@
+package census
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"league.com/rulemaker/money"
+)
+
+const sample = `Employee ID,Birth Date,Earnings Amount
+123, 1980-01-02 ,"$50,000"
+124,,
+`
+
+func TestRead(t *testing.T) {
+	records, err := Read(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Line() != 2 || records[1].Line() != 3 {
+		log.Println("unexpected records", records)
+		t.FailNow()
+	}
+
+	for i, test := range fixture {
+		got, err := records[test.record].Field(test.name, test.kind)
+		if !reflect.DeepEqual(got, test.expected) || (err != nil) != test.err {
+			log.Println("fixture  ", i)
+			log.Println("expected ", test.expected, test.err)
+			log.Println("got      ", got, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDecimalSeparator(t *testing.T) {
+	records, err := ReadWithFormat(strings.NewReader(sample), Format{Decimal: "."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := records[0].Field("earnings_amount", "money")
+	if got != money.FromInt(50000) || err != nil {
+		log.Println("expected", money.FromInt(50000))
+		log.Println("got     ", got, err)
+		t.FailNow()
+	}
+}
+
+var fixture = []struct {
+	record   int
+	name     string
+	kind     string
+	expected interface{}
+	err      bool
+}{
+	{0, "employee_id", "", "123", false},
+	{0, "employee_id", "int", 123, false},
+	{0, "birth_date", "date", time.Date(1980, 1, 2, 0, 0, 0, 0, time.UTC), false},
+	{0, "earnings_amount", "float", 50000.0, false},
+	{0, "birth_date", "int", nil, true},
+	{0, "employee_id", "currency", nil, true},
+	{0, "earnings_amount", "money", nil, true},
+	{0, "missing", "", nil, true},
+	{1, "birth_date", "date", nil, false},
+}
+
+const datesSample = `Hire Date,Birth Date,Start Date,End Date,Serial
+03/04/2020,25/04/1980,2020-01-02,04/13/2020,43831
+05/06/2020,03/04/1980,2020-01-03,13/04/2020,43832
+`
+
+func TestDateFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "census")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dates.csv")
+	if err := ioutil.WriteFile(path, []byte(datesSample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ambiguities := DateAmbiguities(records)
+	expected := []string{
+		"input 'birth_date' has day-first dates such as '25/04/1980'; configure its date format as DD/MM/YYYY",
+		"input 'end_date' mixes day-first ('13/04/2020') and month-first ('04/13/2020') dates",
+		"input 'hire_date' has dates such as '03/04/2020' that could be MM/DD/YYYY or DD/MM/YYYY",
+	}
+	if !reflect.DeepEqual(ambiguities, expected) {
+		log.Println("expected ", expected)
+		log.Println("got      ", ambiguities)
+		t.FailNow()
+	}
+
+	format := `{"dates": ["DD/MM/YYYY", "YYYY-MM-DD"], "inputs": {"serial": ["excel"], "end_date": ["MM/DD/YYYY", "DD/MM/YYYY"]}}`
+	if err := ioutil.WriteFile(path+FormatExtension, []byte(format), 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, err = ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ambiguities := DateAmbiguities(records); len(ambiguities) > 0 {
+		log.Println("unexpected ambiguities", ambiguities)
+		t.FailNow()
+	}
+	for i, test := range dateFixture {
+		got, err := records[test.record].Field(test.name, "date")
+		if !reflect.DeepEqual(got, test.expected) || err != nil {
+			log.Println("fixture  ", i)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", got, err)
+			t.FailNow()
+		}
+	}
+}
+
+var dateFixture = []struct {
+	record   int
+	name     string
+	expected interface{}
+}{
+	{0, "hire_date", time.Date(2020, 4, 3, 0, 0, 0, 0, time.UTC)},
+	{0, "birth_date", time.Date(1980, 4, 25, 0, 0, 0, 0, time.UTC)},
+	{0, "start_date", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+	{0, "end_date", time.Date(2020, 4, 13, 0, 0, 0, 0, time.UTC)},
+	{1, "end_date", time.Date(2020, 4, 13, 0, 0, 0, 0, time.UTC)},
+	{0, "serial", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+}
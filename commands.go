@@ -0,0 +1,364 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"league.com/rulemaker/canonical_model"
+	"league.com/rulemaker/census"
+	"league.com/rulemaker/content"
+	"league.com/rulemaker/diff"
+	"league.com/rulemaker/engine"
+	"league.com/rulemaker/lifecycle"
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/msg"
+	"league.com/rulemaker/parser"
+	"league.com/rulemaker/ruletest"
+	"league.com/rulemaker/store"
+	"league.com/rulemaker/tokenizer"
+	"league.com/rulemaker/util"
+)
+
+const defaultRulesPath = "emp.rules"
+
+func newEngine(models meta.Models) *engine.Engine {
+	en := engine.NewEngine(models[canonical_model.DefaultModel].Metainfo, inputs)
+	en.SetModels(models)
+	en.SetModel(models[canonical_model.DefaultModel])
+	en.SetMaskMode(maskMode())
+	if today, ok := todayDate(); ok {
+		en.SetToday(today)
+	}
+	return en
+}
+
+func todayDate() (time.Time, bool) {
+	if *todayFlag == "" {
+		return time.Time{}, false
+	}
+	today, e := time.Parse("2006-01-02", *todayFlag)
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "invalid -today: %v\n", e)
+		os.Exit(2)
+	}
+	return today, true
+}
+
+func maskMode() meta.MaskMode {
+	switch {
+	case *unmaskFlag:
+		return meta.Unmasked
+	case *hashFlag:
+		return meta.Hashed
+	}
+	return meta.Masked
+}
+
+func selectModel(models meta.Models, path, text string) (meta.Model, error) {
+	name, line := parser.ModelDirective(text)
+	if name == "" {
+		return models[canonical_model.DefaultModel], nil
+	}
+	m, ok := models[name]
+	if !ok {
+		return m, fmt.Errorf("%s:%d:1: unknown model '%s', expected one of %s", path, line+1, name, strings.Join(models.Names(), ", "))
+	}
+	return m, nil
+}
+
+func runCheck(models meta.Models, args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	merging := flags.Bool("merge", false, "Check a merging rules file, which may read fields set by the mapping rules")
+	flags.Parse(args)
+	args = flags.Args()
+	rulesPath := defaultRulesPath
+	if len(args) > 0 {
+		rulesPath = args[0]
+	}
+	text, e := ioutil.ReadFile(rulesPath)
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		return 1
+	}
+	m, e := selectModel(models, rulesPath, string(text))
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		return 1
+	}
+	var records model.Records
+	if len(args) > 1 {
+		if records, e = census.ReadFile(args[1]); e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+			return 1
+		}
+	}
+	p := parser.NewParser(m.Metainfo, inputs, engine.Operations())
+	p.SetRequired(m.Required)
+	p.SetDeclared(census.Columns(records))
+	p.SetMerging(*merging)
+	p.SetPredefined(engine.Variables())
+	p.SetSignatures(engine.Signatures())
+	p.Parse(tokenizer.TokenizeString(string(text)))
+	for _, d := range p.Diagnostics() {
+		fmt.Printf("%s:%d:%d: %s %s: %s\n", rulesPath, d.Token.Line()+1, d.Token.StartColumn()+1, d.Severity, d.Code, d.Message)
+	}
+	for _, ambiguity := range census.DateAmbiguities(records) {
+		fmt.Printf("%s: warning: %s\n", args[1], ambiguity)
+	}
+	if p.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+func runGraph(models meta.Models, args []string) int {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	format := flags.String("format", "dot", "Output format: dot or json")
+	from := flags.String("from", "", "Only show what depends on this input, variable or field")
+	flags.Parse(args)
+	rulesPath := defaultRulesPath
+	if flags.NArg() > 0 {
+		rulesPath = flags.Arg(0)
+	}
+	text, e := ioutil.ReadFile(rulesPath)
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		return 1
+	}
+	m, e := selectModel(models, rulesPath, string(text))
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		return 1
+	}
+	p := parser.NewParser(m.Metainfo, inputs, engine.Operations())
+	p.SetPredefined(engine.Variables())
+	p.SetSignatures(engine.Signatures())
+	p.Parse(tokenizer.TokenizeString(string(text)))
+	edges := p.Graph().Edges()
+	if *from != "" {
+		edges = edges.Downstream(*from)
+	}
+	switch *format {
+	case "dot":
+		fmt.Print(edges.DOT())
+	case "json":
+		fmt.Print(edges.JSON())
+	default:
+		fmt.Fprintf(os.Stderr, "usage: rulemaker graph [-format dot|json] [-from name] [rules]\n")
+		return 2
+	}
+	return 0
+}
+
+func runIngest(models meta.Models, args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	rulesPath := flags.String("rules", defaultRulesPath, "Mapping rules file")
+	mergingRulesPath := flags.String("merge", "", "Merging rules file")
+	storePath := flags.String("store", "", "Snapshot store to compare against and save the new entries to")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "usage: rulemaker run [-rules file] [-merge file] [-store file] census.csv...\n")
+		return 2
+	}
+	en := newEngine(models)
+	var s *store.FileStore
+	if *storePath != "" {
+		text, e := ioutil.ReadFile(*rulesPath)
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+			return 1
+		}
+		m, e := selectModel(models, *rulesPath, string(text))
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+			return 1
+		}
+		if s, e = store.Open(*storePath, m.Metainfo); e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+			return 1
+		}
+		en.SetHistory(s)
+	}
+	for _, censusPath := range flags.Args() {
+		records, e := census.ReadFile(censusPath)
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+			return 1
+		}
+		if e := en.IngestFile(censusPath, records, *rulesPath, *mergingRulesPath, msg.M{}); e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+			return 1
+		}
+	}
+	entries := en.Entries()
+	var changes diff.ChangeLog
+	if s != nil {
+		previous := s.Entries()
+		l := lifecycle.NewLifecycle()
+		if today, ok := todayDate(); ok {
+			l.Today = today
+		}
+		l.Process(previous, entries)
+		changes = diff.Entries(en.Metainfo(), previous, entries)
+	}
+	ids := make([]string, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	failed := false
+	for _, id := range ids {
+		for _, d := range entries[id].Diagnostics {
+			fmt.Printf("%s: %s: %s\n", id, d.Action, d.Message)
+			failed = failed || d.Action == model.Fail
+		}
+	}
+	violations := entries.Violations()
+	names := make([]string, 0, len(violations))
+	for name := range violations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("%d entries\n", len(entries))
+	for _, name := range names {
+		fmt.Printf("%6d %s\n", violations[name], name)
+	}
+	if s == nil {
+		if failed {
+			return 1
+		}
+		return 0
+	}
+	fmt.Printf("%d entries changed since version %d\n", len(changes), s.Version())
+	fmt.Print(changes.Mask(en.Masker()))
+	if failed {
+		fmt.Printf("not saved to %s because of failures\n", *storePath)
+		return 1
+	}
+	version, e := s.Save(entries)
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		return 1
+	}
+	fmt.Printf("saved version %d to %s\n", version, *storePath)
+	return 0
+}
+
+func runSchema(models meta.Models, args []string) int {
+	name := canonical_model.DefaultModel
+	if len(args) > 0 {
+		name = args[0]
+	}
+	m, ok := models[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown model '%s', expected one of %s\n", name, strings.Join(models.Names(), ", "))
+		return 1
+	}
+	fmt.Println(util.ToJson(m.JSONSchema()))
+	return 0
+}
+
+func runTests(models meta.Models, args []string) int {
+	rulesPath := defaultRulesPath
+	if len(args) > 0 {
+		rulesPath = args[0]
+	}
+	testPath := rulesPath + ruletest.Extension
+	if len(args) > 1 {
+		testPath = args[1]
+	}
+	cases, e := ruletest.ReadFile(testPath)
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		return 1
+	}
+	results, e := ruletest.Run(newEngine(models), rulesPath, testPath, cases, msg.M{})
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		return 1
+	}
+	failed := 0
+	for _, result := range results {
+		fmt.Println(result)
+		if !result.Passed() {
+			failed++
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runGolden(models meta.Models, args []string) int {
+	flags := flag.NewFlagSet("golden", flag.ExitOnError)
+	update := flags.Bool("update", false, "Rewrite the golden file with the current output")
+	rulesPath := flags.String("rules", defaultRulesPath, "Mapping rules file")
+	mergingRulesPath := flags.String("merge", "", "Merging rules file")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "usage: rulemaker golden [-update] [-rules file] [-merge file] census.csv [golden.json]\n")
+		return 2
+	}
+	censusPath := flags.Arg(0)
+	goldenPath := censusPath + ruletest.GoldenExtension
+	if flags.NArg() > 1 {
+		goldenPath = flags.Arg(1)
+	}
+	failures, e := ruletest.Golden(newEngine(models), censusPath, *rulesPath, *mergingRulesPath, goldenPath, msg.M{}, *update)
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		return 1
+	}
+	if *update {
+		fmt.Printf("updated %s\n", goldenPath)
+		return 0
+	}
+	for _, failure := range failures {
+		fmt.Println(failure)
+	}
+	if len(failures) > 0 {
+		fmt.Printf("FAIL %s: %d difference(s)\n", goldenPath, len(failures))
+		return 1
+	}
+	fmt.Printf("PASS %s\n", goldenPath)
+	return 0
+}
+
+func runHistory(args []string) int {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	showDiff := flags.Bool("diff", false, "Show the diff of each change")
+	limit := flags.Int("n", 0, "Only show the last n changes")
+	flags.Parse(args)
+	rulesPath := defaultRulesPath
+	if flags.NArg() > 0 {
+		rulesPath = flags.Arg(0)
+	}
+	records, e := content.ReadAudit(content.AuditPath(rulesPath))
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		return 1
+	}
+	records = records.ForFile(rulesPath)
+	if *limit > 0 && len(records) > *limit {
+		records = records[len(records)-*limit:]
+	}
+	if len(records) == 0 {
+		fmt.Printf("no recorded changes to %s\n", rulesPath)
+		return 0
+	}
+	for _, record := range records {
+		fmt.Println(record)
+		if *showDiff {
+			fmt.Print(record.Diff)
+		}
+	}
+	return 0
+}
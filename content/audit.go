@@ -0,0 +1,234 @@
+package content
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const AuditFile = ".rulemaker_audit.log"
+
+const diffContext = 3
+
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Path   string    `json:"path"`
+	Before string    `json:"before,omitempty"`
+	After  string    `json:"after"`
+	Diff   string    `json:"diff"`
+}
+
+type AuditRecords []AuditRecord
+
+func AuditPath(path string) string {
+	return filepath.Join(filepath.Dir(path), AuditFile)
+}
+
+func (r AuditRecord) Stat() (added, removed int) {
+	for _, line := range strings.Split(r.Diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
+
+func (r AuditRecord) String() string {
+	added, removed := r.Stat()
+	before := shortHash(r.Before)
+	if before == "" {
+		before = "(new)"
+	}
+	return fmt.Sprintf("%s  %-12s %s  %s -> %s  +%d -%d", r.Time.Local().Format("2006-01-02 15:04:05"), r.User, r.Path, before, shortHash(r.After), added, removed)
+}
+
+func (r AuditRecords) ForFile(path string) (result AuditRecords) {
+	name := filepath.Base(path)
+	for _, record := range r {
+		if record.Path == name {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+func ReadAudit(path string) (AuditRecords, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var result AuditRecords
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		r := AuditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		result = append(result, r)
+	}
+	return result, scanner.Err()
+}
+
+func appendAudit(path string, record AuditRecord) (err error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return json.NewEncoder(file).Encode(record)
+}
+
+func hash(bytes []byte) string {
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+type diffLine struct {
+	kind     byte
+	text     string
+	old, new int
+}
+
+func UnifiedDiff(name string, before, after []string) string {
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix && before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	oldLines, newLines := before[prefix:len(before)-suffix], after[prefix:len(after)-suffix]
+
+	lengths := make([][]int, len(oldLines)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, diffLine{' ', before[i], i, i})
+	}
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			lines = append(lines, diffLine{' ', oldLines[i], prefix + i, prefix + j})
+			i++
+			j++
+		case j < len(newLines) && (i == len(oldLines) || lengths[i][j+1] > lengths[i+1][j]):
+			lines = append(lines, diffLine{'+', newLines[j], prefix + i, prefix + j})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', oldLines[i], prefix + i, prefix + j})
+			i++
+		}
+	}
+	for k := 0; k < suffix; k++ {
+		i, j := len(before)-suffix+k, len(after)-suffix+k
+		lines = append(lines, diffLine{' ', before[i], i, j})
+	}
+
+	buf := strings.Builder{}
+	for k := 0; k < len(lines); {
+		if lines[k].kind == ' ' {
+			k++
+			continue
+		}
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- a/%s\n+++ b/%s\n", name, name)
+		}
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for l := k; l < len(lines); l++ {
+			if lines[l].kind != ' ' {
+				end = l
+			} else if l-end > 2*diffContext {
+				break
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+		hunk := lines[start:stop]
+		oldCount, newCount := 0, 0
+		for _, line := range hunk {
+			if line.kind != '+' {
+				oldCount++
+			}
+			if line.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(hunk[0].old, oldCount), hunkRange(hunk[0].new, newCount))
+		for _, line := range hunk {
+			fmt.Fprintf(&buf, "%c%s\n", line.kind, line.text)
+		}
+		k = stop
+	}
+	return buf.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
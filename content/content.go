@@ -1,9 +1,12 @@
 package content
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"league.com/rulemaker/model"
 )
@@ -45,8 +48,60 @@ func NewFileContent(path string) (*Content, error) {
 	}, nil
 }
 
+func (c *Content) Text() string {
+	lines := make([]string, len(c.Runes))
+	for i, line := range c.Runes {
+		lines[i] = string(line)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
 func (c *Content) Save() error {
-	return nil // TODO
+	before, err := ioutil.ReadFile(c.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	existed := err == nil
+	after := []byte(c.Text())
+	if existed && bytes.Equal(before, after) {
+		return nil
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(c.Path), "."+filepath.Base(c.Path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(after)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	record := AuditRecord{
+		Time:  time.Now().UTC(),
+		User:  currentUser(),
+		Path:  filepath.Base(c.Path),
+		After: hash(after),
+		Diff:  UnifiedDiff(filepath.Base(c.Path), splitLines(string(before)), splitLines(string(after))),
+	}
+	if existed {
+		record.Before = hash(before)
+	}
+	if err := appendAudit(AuditPath(c.Path), record); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), c.Path)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
 }
 
 func (c *Content) Columns(line int) int {
@@ -124,6 +179,19 @@ func (c *Content) InsertRunes(runes []rune) {
 	c.Cursor.Column += int(len(runes))
 }
 
+func (c *Content) Replace(line, startColumn, endColumn int, runes []rune) {
+	if line >= len(c.Runes) || startColumn > endColumn || endColumn > len(c.Runes[line]) {
+		return
+	}
+	old := c.Runes[line]
+	result := make([]rune, 0, len(old)-(endColumn-startColumn)+len(runes))
+	result = append(result, old[:startColumn]...)
+	result = append(result, runes...)
+	result = append(result, old[endColumn:]...)
+	c.Runes[line] = result
+	c.SetCursor(line, startColumn+len(runes))
+}
+
 func (c *Content) DeleteLeft() {
 	c.Cursor.Column--
 
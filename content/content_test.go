@@ -0,0 +1,153 @@
+package content
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/tokenizer"
+)
+
+var unifiedDiffTests = []struct {
+	before, after string
+	expected      string
+}{
+	{"a\nb\nc", "a\nb\nc", ""},
+	{"", "a\nb", "--- a/x.rules\n+++ b/x.rules\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+	{"a\nb\nc", "a\nB\nc", "--- a/x.rules\n+++ b/x.rules\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+	{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11", "--- a/x.rules\n+++ b/x.rules\n@@ -9,4 +9,3 @@\n 9\n 10\n 11\n-12\n"},
+	{"a\nb\na\nb", "a\nb\nx\na\nb", "--- a/x.rules\n+++ b/x.rules\n@@ -1,4 +1,5 @@\n a\n b\n+x\n a\n b\n"},
+	{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9", "--- a/x.rules\n+++ b/x.rules\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n"},
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, test := range unifiedDiffTests {
+		diff := UnifiedDiff("x.rules", splitLines(test.before), splitLines(test.after))
+		if diff != test.expected {
+			log.Printf("%q -> %q: expected\n%s\ngot\n%s", test.before, test.after, test.expected, diff)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "emp.rules")
+	c := NewContent([][]rune{[]rune("employee_id = $id")})
+	c.Path = path
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c.Runes = append(c.Runes, []rune("city = $city"))
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := ioutil.ReadFile(path)
+	if err != nil || string(text) != "employee_id = $id\ncity = $city\n" {
+		t.Fatal(string(text), err)
+	}
+	records, err := ReadAudit(AuditPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = records.ForFile(path)
+	if len(records) != 2 {
+		log.Println("expected 2 audit records, got", len(records))
+		t.FailNow()
+	}
+	if records[0].Before != "" || records[1].Before != records[0].After || records[1].After != hash(text) {
+		log.Println("unexpected hashes", records)
+		t.FailNow()
+	}
+	if added, removed := records[1].Stat(); added != 1 || removed != 0 || !strings.Contains(records[1].Diff, "+city = $city") {
+		log.Println("unexpected diff", records[1].Diff)
+		t.FailNow()
+	}
+	if records[1].User == "" || records[1].Path != "emp.rules" {
+		log.Println("unexpected record", records[1])
+		t.FailNow()
+	}
+
+	unaudited := filepath.Join(dir, "unaudited")
+	if err := os.MkdirAll(AuditPath(filepath.Join(unaudited, "emp.rules")), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c.Path = filepath.Join(unaudited, "emp.rules")
+	if err := c.Save(); err == nil {
+		log.Println("expected an audit error")
+		t.FailNow()
+	}
+	if files, _ := ioutil.ReadDir(unaudited); len(files) != 1 {
+		log.Println("expected the file to be left unwritten, got", len(files), "files")
+		t.FailNow()
+	}
+}
+
+var searchTests = []struct {
+	search      Search
+	replacement string
+	expected    string
+}{
+	{Search{Pattern: "city"}, "town", "town = (concat $town \"$town\" $town_code) # $town\ntown_name = $town"},
+	{Search{Pattern: "city", CaseSensitive: true}, "town", "town = (concat $town \"$town\" $town_code) # $town\nCITY_name = $town"},
+	{Search{Pattern: "CITY", CaseSensitive: true}, "Town", "city = (concat $city \"$city\" $city_code) # $city\nTown_name = $city"},
+	{Search{Pattern: "$city", TokenType: tokenizer.Input}, "$town", "city = (concat $town \"$city\" $city_code) # $city\nCITY_name = $town"},
+	{Search{Pattern: "city", TokenType: tokenizer.StringLiteral}, "town", "city = (concat $city \"$town\" $city_code) # $city\nCITY_name = $city"},
+	{Search{Pattern: `\$(\w+)_code`, Regex: true}, "${1}_id", "city = (concat $city \"$city\" city_id) # $city\nCITY_name = $city"},
+	{Search{Pattern: "(", Regex: false}, "[", "city = [concat $city \"$city\" $city_code) # $city\nCITY_name = $city"},
+}
+
+func TestSearch(t *testing.T) {
+	text := "city = (concat $city \"$city\" $city_code) # $city\nCITY_name = $city"
+	for _, test := range searchTests {
+		c := NewContent([][]rune{})
+		for _, line := range strings.Split(text, "\n") {
+			c.Runes = append(c.Runes, []rune(line))
+		}
+		if err := test.search.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		matches := test.search.Find(c, tokenizer.TokenizeRunes(c.Runes))
+		test.search.Replace(c, matches, test.replacement)
+		if result := strings.TrimSuffix(c.Text(), "\n"); result != test.expected {
+			log.Printf("%+v: expected\n%s\ngot\n%s", test.search, test.expected, result)
+			t.FailNow()
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	matches := Matches{{Line: 0, Start: 2}, {Line: 1, Start: 0}, {Line: 1, Start: 5}}
+	if match, _ := matches.Next(model.Cursor{Line: 1, Column: 0}, false); match.Start != 5 {
+		log.Println("next:", match)
+		t.FailNow()
+	}
+	if match, _ := matches.Next(model.Cursor{Line: 1, Column: 0}, true); match.Line != 1 || match.Start != 0 {
+		log.Println("next inclusive:", match)
+		t.FailNow()
+	}
+	if match, _ := matches.Next(model.Cursor{Line: 1, Column: 5}, false); match.Line != 0 {
+		log.Println("next wraps:", match)
+		t.FailNow()
+	}
+	if match, _ := matches.Previous(model.Cursor{Line: 0, Column: 2}); match.Line != 1 || match.Start != 5 {
+		log.Println("previous wraps:", match)
+		t.FailNow()
+	}
+	if i, ok := matches.At(model.Cursor{Line: 1, Column: 5}); !ok || i != 2 {
+		log.Println("at:", i, ok)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,145 @@
+package content
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/tokenizer"
+)
+
+type Search struct {
+	Pattern       string
+	Regex         bool
+	CaseSensitive bool
+	TokenType     tokenizer.TokenType
+
+	regexp *regexp.Regexp
+}
+
+type Match struct {
+	Line, Start, End int
+
+	text       string
+	submatches []int
+}
+
+type Matches []Match
+
+func (s *Search) Compile() error {
+	s.regexp = nil
+	if s.Pattern == "" {
+		return nil
+	}
+	pattern := s.Pattern
+	if !s.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !s.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	s.regexp = re
+	return nil
+}
+
+func (s *Search) Find(c *Content, tokens tokenizer.Tokens) (result Matches) {
+	if s.regexp == nil {
+		return nil
+	}
+	for line, runes := range c.Runes {
+		text := string(runes)
+		for _, submatches := range s.regexp.FindAllStringSubmatchIndex(text, -1) {
+			if submatches[0] == submatches[1] {
+				continue
+			}
+			match := Match{
+				Line:       line,
+				Start:      utf8.RuneCountInString(text[:submatches[0]]),
+				End:        utf8.RuneCountInString(text[:submatches[1]]),
+				text:       text,
+				submatches: submatches,
+			}
+			if s.TokenType == tokenizer.InvalidToken || s.inToken(match, tokens) {
+				result = append(result, match)
+			}
+		}
+	}
+	return result
+}
+
+func (s *Search) inToken(match Match, tokens tokenizer.Tokens) bool {
+	for _, token := range tokens {
+		if token.Type() == s.TokenType && token.Line() == match.Line && token.StartColumn() <= match.Start && match.End <= token.EndColumn() {
+			return !symbol(s.TokenType) || wholeWord([]rune(match.text), match.Start, match.End)
+		}
+	}
+	return false
+}
+
+func symbol(tokenType tokenizer.TokenType) bool {
+	switch tokenType {
+	case tokenizer.CanonicalField, tokenizer.Operation, tokenizer.Variable, tokenizer.Input, tokenizer.Label:
+		return true
+	}
+	return false
+}
+
+func wholeWord(runes []rune, start, end int) bool {
+	return (start == 0 || !wordRune(runes[start-1])) && (end == len(runes) || !wordRune(runes[end]))
+}
+
+func wordRune(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
+
+func (s *Search) Replacement(match Match, template string) []rune {
+	if !s.Regex {
+		return []rune(template)
+	}
+	return []rune(string(s.regexp.ExpandString(nil, template, match.text, match.submatches)))
+}
+
+func (s *Search) Replace(c *Content, matches Matches, template string) {
+	for i := len(matches) - 1; i >= 0; i-- {
+		match := matches[i]
+		c.Replace(match.Line, match.Start, match.End, s.Replacement(match, template))
+	}
+}
+
+func (m Matches) Next(cursor model.Cursor, inclusive bool) (Match, bool) {
+	for _, match := range m {
+		if match.Line > cursor.Line || match.Line == cursor.Line && (match.Start > cursor.Column || inclusive && match.Start == cursor.Column) {
+			return match, true
+		}
+	}
+	if len(m) > 0 {
+		return m[0], true
+	}
+	return Match{}, false
+}
+
+func (m Matches) Previous(cursor model.Cursor) (Match, bool) {
+	for i := len(m) - 1; i >= 0; i-- {
+		if match := m[i]; match.Line < cursor.Line || match.Line == cursor.Line && match.Start < cursor.Column {
+			return match, true
+		}
+	}
+	if len(m) > 0 {
+		return m[len(m)-1], true
+	}
+	return Match{}, false
+}
+
+func (m Matches) At(cursor model.Cursor) (int, bool) {
+	for i, match := range m {
+		if match.Line == cursor.Line && match.Start == cursor.Column {
+			return i, true
+		}
+	}
+	return -1, false
+}
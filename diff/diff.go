@@ -0,0 +1,193 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+)
+
+const FieldsToUpdate = "fields_to_update"
+
+type Kind int
+
+const (
+	Added Kind = iota
+	Removed
+	Modified
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "+"
+	case Removed:
+		return "-"
+	case Modified:
+		return "~"
+	}
+	return "?"
+}
+
+type Change struct {
+	Field    string
+	Kind     Kind
+	OldValue interface{}
+	NewValue interface{}
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("%s %s: %v", c.Kind, c.Field, c.NewValue)
+	case Removed:
+		return fmt.Sprintf("%s %s: %v", c.Kind, c.Field, c.OldValue)
+	}
+	return fmt.Sprintf("%s %s: %v -> %v", c.Kind, c.Field, c.OldValue, c.NewValue)
+}
+
+type Changes []Change
+
+func (c Changes) Fields() []string {
+	fields := map[string]struct{}{}
+	for _, change := range c {
+		name, _, _, _ := meta.ParseSelector(meta.SplitPath(change.Field)[0])
+		fields[name] = struct{}{}
+	}
+	result := make([]string, 0, len(fields))
+	for field := range fields {
+		result = append(result, field)
+	}
+	sort.Strings(result)
+	return result
+}
+
+type ChangeLog map[string]Changes
+
+func (l ChangeLog) String() string {
+	ids := make([]string, 0, len(l))
+	for id := range l {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	buf := strings.Builder{}
+	for _, id := range ids {
+		fmt.Fprintf(&buf, "%s:\n", id)
+		for _, change := range l[id] {
+			fmt.Fprintf(&buf, "    %s\n", change)
+		}
+	}
+	return buf.String()
+}
+
+func (l ChangeLog) Mask(masker *meta.Masker) ChangeLog {
+	result := make(ChangeLog, len(l))
+	for id, changes := range l {
+		masked := make(Changes, len(changes))
+		for i, change := range changes {
+			masked[i] = change
+			masked[i].OldValue = masker.Value(change.Field, change.OldValue)
+			masked[i].NewValue = masker.Value(change.Field, change.NewValue)
+		}
+		result[id] = masked
+	}
+	return result
+}
+
+func Compare(metainfo meta.Meta, previous, current model.Entity) (result Changes) {
+	oldValues, newValues := map[string]interface{}{}, map[string]interface{}{}
+	flatten(metainfo, "", previous, oldValues)
+	flatten(metainfo, "", current, newValues)
+	for field, oldValue := range oldValues {
+		newValue, ok := newValues[field]
+		if !ok {
+			result = append(result, Change{Field: field, Kind: Removed, OldValue: oldValue})
+		} else if !equal(oldValue, newValue) {
+			result = append(result, Change{Field: field, Kind: Modified, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+	for field, newValue := range newValues {
+		if _, ok := oldValues[field]; !ok {
+			result = append(result, Change{Field: field, Kind: Added, NewValue: newValue})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Field < result[j].Field })
+	return result
+}
+
+func Entries(metainfo meta.Meta, previous, current model.Entries) ChangeLog {
+	result := ChangeLog{}
+	for id, entry := range current {
+		var previousEntity model.Entity
+		if previousEntry, ok := previous[id]; ok {
+			previousEntity = previousEntry.Entity
+		}
+		changes := Compare(metainfo, previousEntity, entry.Entity)
+		fields := make([]interface{}, 0, len(changes))
+		for _, field := range changes.Fields() {
+			fields = append(fields, field)
+		}
+		entry.Entity[FieldsToUpdate] = fields
+		if len(changes) > 0 {
+			result[id] = changes
+		}
+	}
+	for id, entry := range previous {
+		if _, ok := current[id]; !ok {
+			if changes := Compare(metainfo, entry.Entity, nil); len(changes) > 0 {
+				result[id] = changes
+			}
+		}
+	}
+	return result
+}
+
+func flatten(metainfo meta.Meta, path string, value interface{}, result map[string]interface{}) {
+	switch value := value.(type) {
+	case model.Entity:
+		for key, element := range value {
+			if path == "" && key == FieldsToUpdate {
+				continue
+			}
+			flatten(metainfo, join(path, key), element, result)
+		}
+	case map[string]interface{}:
+		flatten(metainfo, path, model.Entity(value), result)
+	case []model.Entity:
+		for i, element := range value {
+			flatten(metainfo, join(path, strconv.Itoa(i)), element, result)
+		}
+	case []interface{}:
+		for i, element := range value {
+			flatten(metainfo, join(path, strconv.Itoa(i)), element, result)
+		}
+	case nil:
+	default:
+		converted := meta.ConvertValueToType(value, metainfo.Type(path))
+		if _, ok := converted.(error); ok {
+			converted = value
+		}
+		result[path] = converted
+	}
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func equal(one, two interface{}) bool {
+	if oneTime, ok := one.(time.Time); ok {
+		if twoTime, ok := two.(time.Time); ok {
+			return oneTime.Equal(twoTime)
+		}
+	}
+	return reflect.DeepEqual(one, two)
+}
@@ -0,0 +1,93 @@
+package diff
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"league.com/rulemaker/canonical_model"
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/store"
+)
+
+var metainfo = meta.Metainfo(canonical_model.EmployeeDTO{})
+
+func TestEntries(t *testing.T) {
+	previous := model.Entries{
+		"1": {Entity: model.Entity{
+			"employee_id":   "1",
+			"city":          "Toronto",
+			"province":      "ON",
+			"date_of_birth": time.Date(1980, 1, 2, 0, 0, 0, 0, time.UTC),
+			"dependents":    []model.Entity{{"first_name": "Ann"}},
+		}},
+		"2": {Entity: model.Entity{"employee_id": "2"}},
+	}
+
+	dir, err := ioutil.TempDir("", "diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entries.log")
+	s, err := store.Open(path, metainfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Save(previous); err != nil {
+		t.Fatal(err)
+	}
+	s, err = store.Open(path, metainfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous = s.Entries()
+
+	current := model.Entries{
+		"1": {Entity: model.Entity{
+			"employee_id":         "1",
+			"city":                "Ottawa",
+			"date_of_birth":       time.Date(1980, 1, 2, 0, 0, 0, 0, time.UTC),
+			"hrs_worked_per_week": 40,
+			"dependents":          []model.Entity{{"first_name": "Ann"}, {"first_name": "Bob"}},
+		}},
+	}
+
+	got := Entries(metainfo, previous, current)
+	expected := ChangeLog{
+		"1": {
+			{Field: "city", Kind: Modified, OldValue: "Toronto", NewValue: "Ottawa"},
+			{Field: "dependents.1.first_name", Kind: Added, NewValue: "Bob"},
+			{Field: "hrs_worked_per_week", Kind: Added, NewValue: 40.0},
+			{Field: "province", Kind: Removed, OldValue: "ON"},
+		},
+		"2": {
+			{Field: "employee_id", Kind: Removed, OldValue: "2"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		log.Println("expected\n", expected)
+		log.Println("got\n", got)
+		t.FailNow()
+	}
+
+	fields := []interface{}{"city", "dependents", "hrs_worked_per_week", "province"}
+	if !reflect.DeepEqual(current["1"].Entity[FieldsToUpdate], fields) {
+		log.Println("expected", fields)
+		log.Println("got     ", current["1"].Entity[FieldsToUpdate])
+		t.FailNow()
+	}
+
+	current["1"].Entity["date_of_birth"] = time.Date(1981, 2, 2, 0, 0, 0, 0, time.UTC)
+	masked := Entries(metainfo, previous, current).Mask(meta.NewMasker(model.Set{"date_of_birth": {}}, meta.Masked))
+	change := Change{Field: "date_of_birth", Kind: Modified, OldValue: "**********", NewValue: "**********"}
+	if changes := masked["1"]; len(changes) != 5 || !reflect.DeepEqual(changes[1], change) {
+		log.Println("expected a masked date of birth change, got", changes)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,361 @@
+package engine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/msg"
+	"league.com/rulemaker/parser"
+	"league.com/rulemaker/store"
+	"league.com/rulemaker/tokenizer"
+)
+
+const (
+	oldValueVariable      = "_old"
+	newValueVariable      = "_new"
+	previousValueVariable = "_previous"
+)
+
+type Engine struct {
+	model       meta.Model
+	name        string
+	metainfo    meta.Meta
+	idField     string
+	models      meta.Models
+	validators  meta.Validators
+	constraints model.Constraints
+	sensitive   model.Set
+	maskMode    meta.MaskMode
+	inputs      model.Set
+	history     store.Reader
+	entries     model.Entries
+	reported    map[string]model.Diagnostics
+	today       time.Time
+}
+
+func NewEngine(metainfo meta.Meta, inputs model.Set) *Engine {
+	return &Engine{
+		model:    meta.Model{Metainfo: metainfo, IdField: model.DefaultIdField},
+		metainfo: metainfo,
+		idField:  model.DefaultIdField,
+		inputs:   inputs,
+		entries:  model.Entries{},
+		reported: map[string]model.Diagnostics{},
+	}
+}
+
+func (en *Engine) SetModels(models meta.Models) {
+	en.models = models
+}
+
+func (en *Engine) SetModel(m meta.Model) {
+	en.model = m
+	en.use(m)
+}
+
+func (en *Engine) use(m meta.Model) {
+	en.name, en.metainfo, en.idField = m.Name, m.Metainfo, m.IdField
+	en.validators, en.constraints, en.sensitive = m.Validators, m.Constraints, m.Sensitive
+}
+
+func (en *Engine) SetMaskMode(mode meta.MaskMode) {
+	en.maskMode = mode
+}
+
+func (en *Engine) Masker() *meta.Masker {
+	if len(en.sensitive) == 0 || en.maskMode == meta.Unmasked {
+		return nil
+	}
+	return meta.NewMasker(en.sensitive, en.maskMode)
+}
+
+func (en *Engine) Hasher() *meta.Masker {
+	if len(en.sensitive) == 0 {
+		return nil
+	}
+	return meta.NewMasker(en.sensitive, meta.Hashed)
+}
+
+func (en *Engine) Metainfo() meta.Meta {
+	return en.metainfo
+}
+
+func (en *Engine) SetToday(today time.Time) {
+	en.today = today
+}
+
+func (en *Engine) IngestFile(fileName string, records model.Records, mappingRulesPath, mergingRulesPath string, config msg.M) error {
+	mapping, err := en.compileFile(mappingRulesPath, false)
+	if err != nil {
+		return err
+	}
+	var merging program
+	if mergingRulesPath != "" {
+		merging, err = en.compileFile(mergingRulesPath, true)
+		if err != nil {
+			return err
+		}
+	}
+	ingested := model.Set{}
+	for _, record := range records {
+		entry := en.mapRecord(fileName, record, mapping, config, nil, log.Printf)
+		if entry.Has(model.Skip) {
+			continue
+		}
+		id := entry.Entity.Id(en.idField)
+		if id == "" {
+			entry.Report("entity id is missing", "", model.Fail)
+			id = fmt.Sprintf("%s:%d", fileName, record.Line())
+		}
+		if existing, ok := en.entries[id]; ok {
+			old := *existing
+			old.Diagnostics = en.reported[id]
+			entry = en.mergeEntries(&old, entry, merging, config)
+		}
+		en.entries[id] = entry
+		en.reported[id] = entry.Diagnostics
+		ingested[id] = struct{}{}
+	}
+	for id := range ingested {
+		en.validate(en.entries[id])
+	}
+	return nil
+}
+
+func (en *Engine) SetHistory(history store.Reader) {
+	en.history = history
+}
+
+func (en *Engine) Entries() model.Entries {
+	return en.entries
+}
+
+func (en *Engine) compileFile(path string, merging bool) (program, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return en.compileString(path, string(text), merging)
+}
+
+func (en *Engine) compileString(path, text string, merging bool) (program, error) {
+	if err := en.selectModel(path, text, merging); err != nil {
+		return nil, err
+	}
+	tokens := tokenizer.TokenizeString(text)
+	p := parser.NewParser(en.metainfo, en.inputs, Operations())
+	p.SetMerging(merging)
+	p.SetPredefined(Variables())
+	p.SetSignatures(Signatures())
+	p.Parse(tokens)
+	for _, d := range p.Diagnostics() {
+		if d.Severity == parser.Error {
+			return nil, fmt.Errorf("%s:%d:%d: %s", path, d.Token.Line()+1, d.Token.StartColumn()+1, d.Message)
+		}
+	}
+	return compile(tokens, p.OrderedRules()), nil
+}
+
+func (en *Engine) selectModel(path, text string, merging bool) error {
+	name, line := parser.ModelDirective(text)
+	if merging {
+		if name != "" && name != en.name {
+			return fmt.Errorf("%s:%d:1: model '%s' does not match the model '%s' of the mapping rules", path, line+1, name, en.name)
+		}
+		return nil
+	}
+	m := en.model
+	if name != "" {
+		var ok bool
+		if m, ok = en.models[name]; !ok {
+			return fmt.Errorf("%s:%d:1: unknown model '%s'", path, line+1, name)
+		}
+	}
+	en.use(m)
+	return nil
+}
+
+func Variables() model.Set {
+	return model.Set{oldValueVariable: {}, newValueVariable: {}, previousValueVariable: {}}
+}
+
+func (en *Engine) mapRecord(fileName string, record model.Record, rules program, config msg.M, trace Trace, logger logger) *model.Entry {
+	entry := &model.Entry{
+		Entity:  model.Entity{},
+		Sources: model.Sources{{FilePath: fileName, LineNumber: record.Line()}},
+	}
+	e := &evaluation{
+		metainfo:  en.metainfo,
+		record:    record,
+		entry:     entry,
+		variables: msg.M{},
+		config:    config,
+		history:   en.history,
+		trace:     trace,
+		logger:    logger,
+		today:     en.today,
+		idField:   en.idField,
+		masker:    en.Masker(),
+	}
+	if e.masker != nil {
+		entry.SetMasker(e.masker)
+	}
+	e.sensitive = sensitiveSources(rules, e.masker)
+	e.run(rules)
+	return entry
+}
+
+func (en *Engine) validate(entry *model.Entry) {
+	en.validators.Validate(en.metainfo, entry, en.today)
+	meta.CheckConstraints(en.constraints, entry)
+}
+
+func (en *Engine) MapRecords(fileName string, records model.Records, mappingRulesPath string, config msg.M) ([]*model.Entry, error) {
+	mapping, err := en.compileFile(mappingRulesPath, false)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Entry, len(records))
+	for i, record := range records {
+		result[i] = en.mapRecord(fileName, record, mapping, config, nil, log.Printf)
+		en.validate(result[i])
+	}
+	return result, nil
+}
+
+func (en *Engine) DryRun(tokens tokenizer.Tokens, rules parser.Rules, fileName string, record model.Record, config msg.M) (*model.Entry, Trace) {
+	trace := Trace{}
+	entry := en.mapRecord(fileName, record, compile(tokens, rules), config, trace, nil)
+	en.validate(entry)
+	return entry, trace
+}
+
+func (en *Engine) mergeEntries(old, new *model.Entry, rules program, config msg.M) *model.Entry {
+	merged := &model.Entry{
+		Entity:      mergeEntities(old.Entity, new.Entity),
+		Sources:     append(append(model.Sources{}, old.Sources...), new.Sources...),
+		Diagnostics: append(append(model.Diagnostics{}, old.Diagnostics...), new.Diagnostics...),
+	}
+	e := &evaluation{
+		metainfo:  en.metainfo,
+		entry:     merged,
+		variables: msg.M{},
+		config:    config,
+		history:   en.history,
+		merge:     &merge{old: old.Entity, new: new.Entity},
+		logger:    log.Printf,
+		today:     en.today,
+		idField:   en.idField,
+		masker:    en.Masker(),
+	}
+	if e.masker != nil {
+		merged.SetMasker(e.masker)
+	}
+	e.run(rules)
+	return merged
+}
+
+func mergeEntities(old, new model.Entity) model.Entity {
+	result := model.Entity{}
+	for key, value := range old {
+		result[key] = value
+	}
+	for key, newValue := range new {
+		if newValue == nil {
+			continue
+		}
+		switch oldValue := result[key].(type) {
+		case []model.Entity:
+			if newSlice, ok := newValue.([]model.Entity); ok {
+				result[key] = mergeElements(oldValue, newSlice)
+				continue
+			}
+		case model.Entity:
+			if newEntity, ok := newValue.(model.Entity); ok {
+				result[key] = mergeEntities(oldValue, newEntity)
+				continue
+			}
+		}
+		result[key] = newValue
+	}
+	return result
+}
+
+func mergeElements(old, new []model.Entity) []model.Entity {
+	result := append([]model.Entity{}, old...)
+outer:
+	for _, element := range new {
+		for i, existing := range result {
+			if sameElement(existing, element) {
+				result[i] = mergeEntities(existing, element)
+				continue outer
+			}
+		}
+		result = append(result, element)
+	}
+	return result
+}
+
+func sameElement(one, two model.Entity) bool {
+	if reflect.DeepEqual(one, two) {
+		return true
+	}
+	key := elementKey(one)
+	return key != "" && key == elementKey(two) && one[key] != nil && one[key] != "" && reflect.DeepEqual(one[key], two[key])
+}
+
+func elementKey(element model.Entity) string {
+	keys := make([]string, 0, len(element))
+	for key := range element {
+		if strings.HasSuffix(key, "_id") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
+type merge struct {
+	old, new model.Entity
+}
+
+func (m *merge) lookup(name, field string) (interface{}, bool) {
+	switch {
+	case name == oldValueVariable:
+		return meta.Get(m.old, field), true
+	case name == newValueVariable:
+		return meta.Get(m.new, field), true
+	case strings.HasPrefix(name, oldValueVariable+"."):
+		return meta.Get(m.old, name[len(oldValueVariable)+1:]), true
+	case strings.HasPrefix(name, newValueVariable+"."):
+		return meta.Get(m.new, name[len(newValueVariable)+1:]), true
+	}
+	return nil, false
+}
+
+func (e *evaluation) previous(name string) (interface{}, bool) {
+	if name != previousValueVariable && !strings.HasPrefix(name, previousValueVariable+".") {
+		return nil, false
+	}
+	if e.history == nil {
+		return nil, true
+	}
+	entry := e.history.Entry(e.entry.Entity.Id(e.idField))
+	if entry == nil {
+		return nil, true
+	}
+	if name == previousValueVariable {
+		return meta.Get(entry.Entity, e.field), true
+	}
+	return meta.Get(entry.Entity, name[len(previousValueVariable)+1:]), true
+}
@@ -0,0 +1,639 @@
+package engine
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"league.com/rulemaker/canonical_model"
+	"league.com/rulemaker/census"
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/money"
+	"league.com/rulemaker/msg"
+	"league.com/rulemaker/parser"
+	"league.com/rulemaker/store"
+	"league.com/rulemaker/tokenizer"
+)
+
+type testRecord struct {
+	line   int
+	fields msg.M
+}
+
+func (r testRecord) Line() int {
+	return r.line
+}
+
+func (r testRecord) Field(name, kind string) (interface{}, error) {
+	return r.fields[name], nil
+}
+
+var testInputs = model.Set{
+	"employee_id":     {},
+	"effective_date":  {},
+	"earnings_amount": {},
+	"hours":           {},
+	"dependant_name":  {},
+	"dependant_id":    {},
+	"dependant_sex":   {},
+	"person_type":     {},
+	"city":            {},
+	"province_state":  {},
+	"gender":          {},
+}
+
+const mappingRules = `
+employee_id = $employee_id;
+_skip = (map $person_type X: (skip "not an employee"));
+annual_earnings = $earnings_amount;
+annual_earnings_effective_date = $effective_date;
+hrs_worked_per_week = $hours;
+dependents.+.first_name = $dependant_name;
+`
+
+const mergingRules = `
+annual_earnings = (latest annual_earnings_effective_date);
+annual_earnings_effective_date = (max _old _new);
+hrs_worked_per_week = (max _old _new);
+`
+
+func writeRules(t *testing.T, dir, name, text string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIngestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mappingPath := writeRules(t, dir, "emp.rules", mappingRules)
+	mergingPath := writeRules(t, dir, "emp.merge.rules", mergingRules)
+
+	records := model.Records{
+		testRecord{1, msg.M{"employee_id": "1", "effective_date": "2020-02-01", "earnings_amount": "$50,000.00", "hours": 40, "dependant_name": "Ann"}},
+		testRecord{2, msg.M{"employee_id": "1", "effective_date": "2020-01-01", "earnings_amount": "45000", "hours": 35, "dependant_name": "Bob"}},
+		testRecord{3, msg.M{"employee_id": "2", "effective_date": "2020-01-01", "earnings_amount": "1000", "hours": 20}},
+		testRecord{4, msg.M{"employee_id": "3", "person_type": "X"}},
+	}
+
+	e := NewEngine(meta.Metainfo(canonical_model.EmployeeDTO{}), testInputs)
+	if err := e.IngestFile("census.csv", records, mappingPath, mergingPath, msg.M{}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := e.Entries()
+	if len(entries) != 2 {
+		log.Println("entries", entries)
+		t.FailNow()
+	}
+
+	entry := entries["1"]
+	expected := model.Entity{
+		"employee_id":                    "1",
+		"annual_earnings":                money.FromInt(50000),
+		"annual_earnings_effective_date": time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+		"hrs_worked_per_week":            40.0,
+		"dependents": []model.Entity{
+			{"first_name": "Ann"},
+			{"first_name": "Bob"},
+		},
+	}
+	if !reflect.DeepEqual(entry.Entity, expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", entry.Entity)
+		t.FailNow()
+	}
+	sources := model.Sources{{FilePath: "census.csv", LineNumber: 1}, {FilePath: "census.csv", LineNumber: 2}}
+	if !reflect.DeepEqual(entry.Sources, sources) {
+		log.Println("expected", sources)
+		log.Println("got     ", entry.Sources)
+		t.FailNow()
+	}
+}
+
+func TestMergeReadsMappedField(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mappingPath := writeRules(t, dir, "emp.rules", `
+employee_id = $employee_id;
+city = $city;
+annual_earnings_effective_date = $effective_date;
+`)
+	mergingPath := writeRules(t, dir, "emp.merge.rules", `
+city = (latest annual_earnings_effective_date);
+`)
+	records := model.Records{
+		testRecord{1, msg.M{"employee_id": "1", "city": "Ottawa", "effective_date": "2020-02-01"}},
+		testRecord{2, msg.M{"employee_id": "1", "city": "Toronto", "effective_date": "2020-01-01"}},
+	}
+	e := NewEngine(meta.Metainfo(canonical_model.EmployeeDTO{}), testInputs)
+	if err := e.IngestFile("census.csv", records, mappingPath, mergingPath, msg.M{}); err != nil {
+		log.Println("merging rules that only read a mapped field should compile:", err)
+		t.FailNow()
+	}
+	if city := e.Entries()["1"].Entity["city"]; city != "Ottawa" {
+		log.Println("expected the city of the latest record, got", city)
+		t.FailNow()
+	}
+}
+
+func TestCensusDateFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	censusPath := writeRules(t, dir, "census.csv", "Employee ID,Birth Date\n1,03/04/1980\n2,25/12/1980\n")
+	writeRules(t, dir, "census.csv"+census.FormatExtension, `{"dates": ["DD/MM/YYYY"]}`)
+	mappingPath := writeRules(t, dir, "emp.rules", `
+employee_id = $employee_id;
+date_of_birth = $birth_date;
+`)
+	records, err := census.ReadFile(censusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(meta.Metainfo(canonical_model.EmployeeDTO{}), model.Set{"employee_id": {}, "birth_date": {}})
+	if err := e.IngestFile(censusPath, records, mappingPath, "", msg.M{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]time.Time{"1": time.Date(1980, 4, 3, 0, 0, 0, 0, time.UTC), "2": time.Date(1980, 12, 25, 0, 0, 0, 0, time.UTC)}
+	for id, date := range expected {
+		entry := e.Entries()[id]
+		if entry == nil || entry.Entity["date_of_birth"] != date || len(entry.Diagnostics) > 0 {
+			log.Println("expected", id, date)
+			log.Println("got     ", entry)
+			t.FailNow()
+		}
+	}
+}
+
+func TestMergeWithoutRules(t *testing.T) {
+	old := model.Entity{"employee_id": "1", "city": "Toronto", "dependents": []model.Entity{{"first_name": "Ann"}}}
+	new := model.Entity{"employee_id": "1", "city": "Ottawa", "province": nil, "dependents": []model.Entity{{"first_name": "Bob"}}}
+	got := mergeEntities(old, new)
+	expected := model.Entity{"employee_id": "1", "city": "Ottawa", "dependents": []model.Entity{{"first_name": "Ann"}, {"first_name": "Bob"}}}
+	if !reflect.DeepEqual(got, expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", got)
+		t.FailNow()
+	}
+
+	got = mergeEntities(got, new)
+	if !reflect.DeepEqual(got, expected) {
+		log.Println("re-merging duplicated elements")
+		log.Println("expected", expected)
+		log.Println("got     ", got)
+		t.FailNow()
+	}
+
+	old = model.Entity{"dependents": []model.Entity{{"dependent_id": "1", "first_name": "Ann"}, {"dependent_id": "2", "first_name": "Bob"}}}
+	new = model.Entity{"dependents": []model.Entity{{"dependent_id": "2", "sex": "M"}, {"dependent_id": "3", "first_name": "Cy"}}}
+	got = mergeEntities(old, new)
+	expected = model.Entity{"dependents": []model.Entity{{"dependent_id": "1", "first_name": "Ann"}, {"dependent_id": "2", "first_name": "Bob", "sex": "M"}, {"dependent_id": "3", "first_name": "Cy"}}}
+	if !reflect.DeepEqual(got, expected) {
+		log.Println("merging by key")
+		log.Println("expected", expected)
+		log.Println("got     ", got)
+		t.FailNow()
+	}
+}
+
+func TestKeyedSliceUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mappingPath := writeRules(t, dir, "emp.rules", `
+employee_id = $employee_id;
+dependents[dependent_id=$dependant_id].first_name = $dependant_name;
+dependents[dependent_id=$dependant_id].sex = $dependant_sex;
+`)
+
+	records := model.Records{
+		testRecord{1, msg.M{"employee_id": "1", "dependant_id": "A", "dependant_name": "Ann", "dependant_sex": "F"}},
+		testRecord{2, msg.M{"employee_id": "2"}},
+	}
+
+	e := NewEngine(meta.Metainfo(canonical_model.EmployeeDTO{}), testInputs)
+	if err := e.IngestFile("census.csv", records, mappingPath, "", msg.M{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []model.Entity{{"dependent_id": "A", "first_name": "Ann", "sex": "F"}}
+	if got := e.Entries()["1"].Entity["dependents"]; !reflect.DeepEqual(got, expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", got)
+		t.FailNow()
+	}
+	if diagnostics := e.Entries()["2"].Diagnostics; len(diagnostics) != 0 {
+		log.Println("unexpected diagnostics", diagnostics)
+		t.FailNow()
+	}
+}
+
+func TestPreviousValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mappingPath := writeRules(t, dir, "emp.rules", `
+employee_id = $employee_id;
+annual_earnings = (max $earnings_amount _previous);
+city = _previous.city;
+`)
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	history, err := store.Open(filepath.Join(dir, "entries.log"), metainfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := history.Save(model.Entries{"1": {Entity: model.Entity{"employee_id": "1", "annual_earnings": money.FromInt(60000), "city": "Toronto"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	records := model.Records{
+		testRecord{1, msg.M{"employee_id": "1", "earnings_amount": 50000}},
+		testRecord{2, msg.M{"employee_id": "2", "earnings_amount": 50000}},
+	}
+	e := NewEngine(metainfo, testInputs)
+	e.SetHistory(history)
+	if err := e.IngestFile("census.csv", records, mappingPath, "", msg.M{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := model.Entries{
+		"1": {Entity: model.Entity{"employee_id": "1", "annual_earnings": money.FromInt(60000), "city": "Toronto"}, Sources: model.Sources{{FilePath: "census.csv", LineNumber: 1}}},
+		"2": {Entity: model.Entity{"employee_id": "2", "annual_earnings": money.FromInt(50000)}, Sources: model.Sources{{FilePath: "census.csv", LineNumber: 2}}},
+	}
+	if !reflect.DeepEqual(e.Entries(), expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", e.Entries())
+		t.FailNow()
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	tokens := tokenizer.TokenizeString("employee_id = $employee_id;\ndependents.+.first_name = $dependant_name;\ncity = (")
+	p := parser.NewParser(metainfo, testInputs, Operations())
+	p.Parse(tokens)
+
+	e := NewEngine(metainfo, testInputs)
+	entry, trace := e.DryRun(tokens, p.Rules(), "sample.csv", testRecord{2, msg.M{"employee_id": "1", "dependant_name": "Ann"}}, msg.M{})
+	expected := model.Entity{"employee_id": "1", "dependents": []model.Entity{{"first_name": "Ann"}}}
+	if !reflect.DeepEqual(entry.Entity, expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", entry.Entity)
+		t.FailNow()
+	}
+	if token, ok := trace.Rule("dependents.0.first_name"); !ok || token.Line() != 1 {
+		log.Println("unexpected trace", trace)
+		t.FailNow()
+	}
+	if _, ok := trace.Rule("city"); ok {
+		log.Println("unexpected trace", trace)
+		t.FailNow()
+	}
+}
+
+func TestDryRunLog(t *testing.T) {
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	tokens := tokenizer.TokenizeString(`city = (log $city);`)
+	p := parser.NewParser(metainfo, testInputs, Operations())
+	p.Parse(tokens)
+
+	output := &strings.Builder{}
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+	entry, _ := NewEngine(metainfo, testInputs).DryRun(tokens, p.OrderedRules(), "sample.csv", testRecord{1, msg.M{"city": "Ottawa"}}, msg.M{})
+	if output.Len() > 0 || len(entry.Diagnostics) != 1 || entry.Diagnostics[0].Action != model.Log {
+		log.Println("expected only a log diagnostic, got", output.String(), entry.Diagnostics)
+		t.FailNow()
+	}
+}
+
+func TestWeeklyHours(t *testing.T) {
+	for i, params := range weeklyHoursFixture {
+		result := weeklyHours(&evaluation{}, []expression{literal{params.hours}, literal{params.frequency}})
+		if err, ok := result.(error); ok && err.Error() != params.expected || !ok && result != params.expected {
+			log.Println("fixture  ", i)
+			log.Println("expected ", params.expected)
+			log.Println("got      ", result)
+			t.FailNow()
+		}
+	}
+}
+
+var weeklyHoursFixture = []struct {
+	hours, frequency, expected interface{}
+}{
+	{40, "weekly", 40.0},
+	{"75", "Biweekly", 37.5},
+	{"130", "monthly", 30.0},
+	{nil, "weekly", nil},
+	{40, "fortnightly", "unknown pay frequency 'fortnightly'"},
+}
+
+func TestDependencyOrder(t *testing.T) {
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	tokens := tokenizer.TokenizeString("city = (join \" \" _name province);\n_name = (+ first_name \"!\");\nfirst_name = $given_names;\nprovince = \"ON\";")
+	p := parser.NewParser(metainfo, testInputs, Operations())
+	p.Parse(tokens)
+
+	e := NewEngine(metainfo, testInputs)
+	entry, _ := e.DryRun(tokens, p.OrderedRules(), "sample.csv", testRecord{2, msg.M{"given_names": "Ann"}}, msg.M{})
+	expected := model.Entity{"city": "Ann! ON", "first_name": "Ann", "province": "ON"}
+	if !reflect.DeepEqual(entry.Entity, expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", entry.Entity)
+		t.FailNow()
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	tokens := tokenizer.TokenizeString(`
+		city = (if (= $person_type "E") $city (fail "not an employee"));
+		province = (cond (= $province_state "Ontario") "ON" (= $province_state "Quebec") "QC" (fail "unknown province"));
+		sex = (case $gender M: "male" F: "female" (fail "unknown gender"));
+		title = (if (= $person_type "D") "dependent");`)
+	p := parser.NewParser(metainfo, testInputs, Operations())
+	p.SetSignatures(Signatures())
+	p.Parse(tokens)
+	if p.HasErrors() {
+		log.Println(p.Diagnostics())
+		t.FailNow()
+	}
+
+	e := NewEngine(metainfo, testInputs)
+	record := testRecord{2, msg.M{"person_type": "E", "city": "Toronto", "province_state": "Quebec", "gender": "F"}}
+	entry, _ := e.DryRun(tokens, p.OrderedRules(), "sample.csv", record, msg.M{})
+	expected := model.Entity{"city": "Toronto", "province": "QC", "sex": "female"}
+	if !reflect.DeepEqual(entry.Entity, expected) || entry.Has(model.Fail) {
+		log.Println("expected", expected)
+		log.Println("got     ", entry.Entity, entry.Diagnostics)
+		t.FailNow()
+	}
+
+	record = testRecord{3, msg.M{"person_type": "D", "city": "Toronto", "province_state": "Yukon", "gender": "F"}}
+	entry, _ = e.DryRun(tokens, p.OrderedRules(), "sample.csv", record, msg.M{})
+	if len(entry.Diagnostics) != 2 || entry.Diagnostics[0].Field != "city" || entry.Diagnostics[1].Field != "province" {
+		log.Println("unexpected diagnostics", entry.Diagnostics)
+		t.FailNow()
+	}
+}
+
+func TestDateArithmetic(t *testing.T) {
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	tokens := tokenizer.TokenizeString(`
+		date_of_hire = $effective_date:date;
+		benefits_start_date = (first_of_month (+ date_of_hire 1m));
+		enrollment_end_date = (+ date_of_hire 1m);
+		suspended_date = (- date_of_hire 1y 2d);
+		activation_date = today;
+		hrs_worked_per_week = (- today date_of_hire);
+		employee_leave_start_date = (+ $termination_date:date 1d);
+		employee_leave = (if (< (- today 30d) date_of_hire) "recent" "settled");`)
+	p := parser.NewParser(metainfo, model.Set{"effective_date": {}, "termination_date": {}}, Operations())
+	p.SetSignatures(Signatures())
+	p.Parse(tokens)
+	if p.HasErrors() {
+		log.Println(p.Diagnostics())
+		t.FailNow()
+	}
+
+	e := NewEngine(metainfo, testInputs)
+	e.SetToday(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC))
+	entry, _ := e.DryRun(tokens, p.OrderedRules(), "sample.csv", testRecord{2, msg.M{"effective_date": "2020-01-31"}}, msg.M{})
+	expected := model.Entity{
+		"date_of_hire":        time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC),
+		"benefits_start_date": time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+		"enrollment_end_date": time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		"suspended_date":      time.Date(2019, 1, 29, 0, 0, 0, 0, time.UTC),
+		"activation_date":     time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+		"hrs_worked_per_week": 30.0,
+		"employee_leave":      "settled",
+	}
+	if !reflect.DeepEqual(entry.Entity, expected) || len(entry.Diagnostics) > 0 {
+		log.Println("expected", expected)
+		log.Println("got     ", entry.Entity, entry.Diagnostics)
+		t.FailNow()
+	}
+}
+
+func TestMoney(t *testing.T) {
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	tokens := tokenizer.TokenizeString(`
+		annual_earnings = (* $earnings_amount 26);
+		annual_earnings_for_pooled_benefits = (- (+ annual_earnings "(100.10)") 0.1);`)
+	p := parser.NewParser(metainfo, testInputs, Operations())
+	p.Parse(tokens)
+
+	e := NewEngine(metainfo, testInputs)
+	entry, _ := e.DryRun(tokens, p.OrderedRules(), "sample.csv", testRecord{2, msg.M{"earnings_amount": money.FromCents(192308)}}, msg.M{})
+	expected := model.Entity{
+		"annual_earnings":                     money.FromCents(5000008),
+		"annual_earnings_for_pooled_benefits": money.FromCents(4989988),
+	}
+	if !reflect.DeepEqual(entry.Entity, expected) || len(entry.Diagnostics) > 0 {
+		log.Println("expected", expected)
+		log.Println("got     ", entry.Entity, entry.Diagnostics)
+		t.FailNow()
+	}
+}
+
+func TestCustomFields(t *testing.T) {
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{}).WithSchema("custom_fields", meta.Meta{"seniority_date": meta.Date, "union": meta.Bool})
+	tokens := tokenizer.TokenizeString(`
+		custom_fields.seniority_date = $effective_date;
+		custom_fields.union = (= $person_type "U");
+		custom_fields.local = "12";`)
+	p := parser.NewParser(metainfo, testInputs, Operations())
+	p.Parse(tokens)
+	if d := p.Diagnostics(); len(d) == 0 || d[len(d)-1].Code != parser.UndefinedField {
+		log.Println("expected custom_fields.local to be reported", d)
+		t.FailNow()
+	}
+
+	e := NewEngine(metainfo, testInputs)
+	entry, _ := e.DryRun(tokens, p.OrderedRules(), "sample.csv", testRecord{2, msg.M{"effective_date": "2019-05-01", "person_type": "U"}}, msg.M{})
+	expected := model.Entity{"custom_fields": model.Entity{
+		"seniority_date": time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC),
+		"union":          true,
+		"local":          "12",
+	}}
+	if !reflect.DeepEqual(entry.Entity, expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", entry.Entity)
+		t.FailNow()
+	}
+}
+
+func TestModels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mappingPath := writeRules(t, dir, "dep.rules", `
+# Dependents feed
+# model: dependent
+employee_id = $employee_id;
+dependent_id = $dependant_id;
+first_name = $dependant_name;
+`)
+	unknownPath := writeRules(t, dir, "unknown.rules", "# model: pension\nemployee_id = $employee_id;\n")
+
+	models := meta.Models{}
+	for name, m := range canonical_model.Models {
+		models[name] = meta.NewModel(name, m.Entity, m.IdField)
+	}
+	records := model.Records{
+		testRecord{1, msg.M{"employee_id": "1", "dependant_id": "A", "dependant_name": "Ann"}},
+		testRecord{2, msg.M{"employee_id": "1", "dependant_id": "B", "dependant_name": "Bob"}},
+	}
+
+	e := NewEngine(models[canonical_model.DefaultModel].Metainfo, testInputs)
+	e.SetModels(models)
+	e.SetModel(models[canonical_model.DefaultModel])
+	if err := e.IngestFile("dependents.csv", records, mappingPath, "", msg.M{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := model.Entity{"employee_id": "1", "dependent_id": "B", "first_name": "Bob"}
+	if entries := e.Entries(); len(entries) != 2 || !reflect.DeepEqual(entries["B"].Entity, expected) {
+		log.Println("expected entries keyed by dependent_id", entries)
+		t.FailNow()
+	}
+	if e.Metainfo().Type("relationship") != meta.String {
+		log.Println("expected the dependent metainfo")
+		t.FailNow()
+	}
+
+	employeePath := writeRules(t, dir, "emp.rules", "employee_id = $employee_id;\n")
+	if err := e.IngestFile("census.csv", records, employeePath, "", msg.M{}); err != nil {
+		t.Fatal(err)
+	}
+	if entries := e.Entries(); len(entries) != 3 || entries["1"] == nil || e.Metainfo().Type("relationship") != meta.Invalid {
+		log.Println("expected a file without a directive to use the default model", entries)
+		t.FailNow()
+	}
+
+	e = NewEngine(models[canonical_model.DefaultModel].Metainfo, testInputs)
+	e.SetModels(models)
+	e.SetModel(models[canonical_model.DefaultModel])
+	mergingPath := writeRules(t, dir, "dep.merge.rules", "# model: dependent\nfirst_name = _new;\n")
+	err = e.IngestFile("census.csv", records, employeePath, mergingPath, msg.M{})
+	if err == nil || err.Error() != mergingPath+":1:1: model 'dependent' does not match the model 'employee' of the mapping rules" {
+		log.Println("expected mismatched model error, got", err)
+		t.FailNow()
+	}
+	if err := e.IngestFile("dependents.csv", records, mappingPath, mergingPath, msg.M{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewEngine(models[canonical_model.DefaultModel].Metainfo, testInputs).IngestFile("census.csv", records, unknownPath, "", msg.M{})
+	if err == nil || err.Error() != unknownPath+":1:1: unknown model 'pension'" {
+		log.Println("expected unknown model error, got", err)
+		t.FailNow()
+	}
+}
+
+func TestValidation(t *testing.T) {
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	validators := meta.Validators{{Field: "province", Kind: meta.ProvinceValidator, Action: model.Ticket}}
+	if err := validators.Prepare(metainfo); err != nil {
+		t.Fatal(err)
+	}
+	tokens := tokenizer.TokenizeString(`province = $province_state;`)
+	p := parser.NewParser(metainfo, testInputs, Operations())
+	p.Parse(tokens)
+
+	e := NewEngine(metainfo, testInputs)
+	e.SetModel(meta.Model{Metainfo: metainfo, IdField: "employee_id", Validators: validators})
+	entry, _ := e.DryRun(tokens, p.OrderedRules(), "sample.csv", testRecord{1, msg.M{"province_state": "Ontario"}}, msg.M{})
+	expected := model.Diagnostics{{Message: "province: 'Ontario' is not a Canadian province or territory code", Field: "province", Action: model.Ticket}}
+	if !reflect.DeepEqual(entry.Diagnostics, expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", entry.Diagnostics)
+		t.FailNow()
+	}
+}
+
+func TestMaskDiagnostics(t *testing.T) {
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	for i, test := range maskFixture {
+		tokens := tokenizer.TokenizeString(test.rules)
+		p := parser.NewParser(metainfo, model.Set{"birth_date": {}}, Operations())
+		p.Parse(tokens)
+		records, err := census.Read(strings.NewReader("Birth Date\n" + test.birthDate + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := NewEngine(metainfo, model.Set{"birth_date": {}})
+		e.SetModel(meta.Model{Metainfo: metainfo, IdField: "employee_id", Sensitive: model.Set{"date_of_birth": {}}})
+		entry, _ := e.DryRun(tokens, p.OrderedRules(), "sample.csv", records[0], msg.M{})
+		if len(entry.Diagnostics) != 1 || strings.Contains(entry.Diagnostics[0].Message, test.birthDate) {
+			log.Println("fixture  ", i)
+			log.Println("expected a masked diagnostic, got", entry.Diagnostics)
+			t.FailNow()
+		}
+	}
+}
+
+var maskFixture = []struct {
+	rules     string
+	birthDate string
+}{
+	{"date_of_birth = $birth_date;", "1980-31-31"},
+	{"_dob = $birth_date:date;\ndate_of_birth = _dob;", "1980-31-31"},
+	{"_dob = $birth_date;\ndate_of_birth = _dob;\n_x = (log _dob $birth_date);", "1980-01-02"},
+}
+
+func TestValidateMergedEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mappingPath := writeRules(t, dir, "emp.rules", `
+employee_id = $employee_id;
+first_name = $first_name;
+date_of_hire = $hire_date;
+termination_date = $end_date;
+`)
+	records := model.Records{
+		testRecord{1, msg.M{"employee_id": "1", "first_name": "Ann", "hire_date": "2020-05-01"}},
+		testRecord{2, msg.M{"employee_id": "1", "end_date": "2020-01-01"}},
+	}
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	constraints := append(meta.RequiredConstraints(model.Set{"first_name": {}}), canonical_model.Models[canonical_model.DefaultModel].Constraints...)
+	e := NewEngine(metainfo, model.Set{"employee_id": {}, "first_name": {}, "hire_date": {}, "end_date": {}})
+	e.SetModel(meta.Model{Metainfo: metainfo, IdField: "employee_id", Constraints: constraints})
+	for i := 0; i < 2; i++ {
+		if err := e.IngestFile("census.csv", records, mappingPath, "", msg.M{}); err != nil {
+			t.Fatal(err)
+		}
+		if violations := e.Entries().Violations(); !reflect.DeepEqual(violations, map[string]int{"hired_before_termination": 1}) {
+			log.Println("expected only the merged entity's violation, got", violations)
+			log.Println(e.Entries()["1"].Diagnostics)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/msg"
+	"league.com/rulemaker/parser"
+	"league.com/rulemaker/store"
+	"league.com/rulemaker/tokenizer"
+)
+
+type expression interface {
+	eval(e *evaluation) interface{}
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (l literal) eval(e *evaluation) interface{} {
+	return l.value
+}
+
+type label struct {
+	name string
+}
+
+func (l label) eval(e *evaluation) interface{} {
+	return l.name
+}
+
+type today struct{}
+
+func (today) eval(e *evaluation) interface{} {
+	if !e.today.IsZero() {
+		return e.today
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type span struct {
+	years, months, days int
+}
+
+func (s span) plus(other span) span {
+	return span{years: s.years + other.years, months: s.months + other.months, days: s.days + other.days}
+}
+
+func (s span) negate() span {
+	return span{years: -s.years, months: -s.months, days: -s.days}
+}
+
+func (s span) String() string {
+	return fmt.Sprintf("%dy%dm%dd", s.years, s.months, s.days)
+}
+
+func addSpan(date time.Time, s span) time.Time {
+	year, month, day := date.Date()
+	firstOfMonth := time.Date(year+s.years, month+time.Month(s.months), 1, 0, 0, 0, 0, date.Location())
+	if last := firstOfMonth.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	hour, minute, second := date.Clock()
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day+s.days, hour, minute, second, date.Nanosecond(), date.Location())
+}
+
+type input struct {
+	name, kind string
+}
+
+func (i input) eval(e *evaluation) interface{} {
+	if e.record == nil {
+		return fmt.Errorf("input '$%s' is not available", i.name)
+	}
+	value, err := e.record.Field(i.name, i.kind)
+	if err != nil {
+		return err
+	}
+	return value
+}
+
+type field struct {
+	path string
+}
+
+func (f field) eval(e *evaluation) interface{} {
+	path, err := e.resolvePath(f.path)
+	if err != nil {
+		return err
+	}
+	return meta.Get(e.entry.Entity, path)
+}
+
+type variable struct {
+	name string
+}
+
+func (v variable) eval(e *evaluation) interface{} {
+	if e.merge != nil {
+		if value, ok := e.merge.lookup(v.name, e.field); ok {
+			return value
+		}
+	}
+	if value, ok := e.previous(v.name); ok {
+		return value
+	}
+	return e.variables[v.name]
+}
+
+type call struct {
+	token tokenizer.Token
+	name  string
+	op    operation
+	args  []expression
+}
+
+func (c call) eval(e *evaluation) interface{} {
+	if c.op.eval == nil {
+		return fmt.Errorf("operation '%s' is not defined", c.name)
+	}
+	if err := c.checkArity(); err != nil {
+		return err
+	}
+	return c.op.eval(e, c.args)
+}
+
+type unsupported struct {
+	text string
+}
+
+func (u unsupported) eval(e *evaluation) interface{} {
+	return fmt.Errorf("'%s' is not supported", u.text)
+}
+
+type rule struct {
+	token tokenizer.Token
+	field string
+	body  expression
+}
+
+type program []rule
+
+func compile(tokens tokenizer.Tokens, rules parser.Rules) (result program) {
+	for _, r := range rules {
+		if r.Field < 0 {
+			continue
+		}
+		var body []tokenizer.Token
+		for i := r.Body + 1; i < r.End; i++ {
+			tokenType := tokens[i].Type()
+			if tokenType != tokenizer.Comment && tokenType != tokenizer.Semicolon {
+				body = append(body, tokens[i])
+			}
+		}
+		if len(body) == 0 {
+			continue
+		}
+		token := tokens[r.Field]
+		expr, _ := compileExpression(tokens, body)
+		result = append(result, rule{token: token, field: tokens.Text(token), body: expr})
+	}
+	return result
+}
+
+func compileExpression(tokens tokenizer.Tokens, body []tokenizer.Token) (expression, []tokenizer.Token) {
+	token := body[0]
+	body = body[1:]
+	switch token.Type() {
+	case tokenizer.OpenParenthesis:
+		if len(body) == 0 {
+			return unsupported{text: tokens.Text(token)}, body
+		}
+		c := call{token: body[0], name: tokens.Text(body[0])}
+		c.op = operations[c.name]
+		body = body[1:]
+		for len(body) > 0 && body[0].Type() != tokenizer.CloseParenthesis {
+			var arg expression
+			arg, body = compileExpression(tokens, body)
+			c.args = append(c.args, arg)
+		}
+		if len(body) > 0 {
+			body = body[1:]
+		}
+		return c, body
+	case tokenizer.CanonicalField:
+		return field{path: tokens.Text(token)}, body
+	case tokenizer.Variable:
+		return variable{name: tokens.Text(token)}, body
+	case tokenizer.Input:
+		parts := strings.SplitN(token.Value().(string), ":", 2)
+		in := input{name: parts[0]}
+		if len(parts) > 1 {
+			in.kind = parts[1]
+		}
+		return in, body
+	case tokenizer.Label:
+		return label{name: strings.TrimSuffix(tokens.Text(token), ":")}, body
+	case tokenizer.TodayLiteral:
+		return today{}, body
+	case tokenizer.YearSpanLiteral:
+		return literal{value: span{years: token.Value().(int)}}, body
+	case tokenizer.MonthSpanLiteral:
+		return literal{value: span{months: token.Value().(int)}}, body
+	case tokenizer.DaySpanLiteral:
+		return literal{value: span{days: token.Value().(int)}}, body
+	case tokenizer.StringLiteral, tokenizer.IntegerLiteral, tokenizer.RealLiteral,
+		tokenizer.BooleanLiteral, tokenizer.NilLiteral, tokenizer.DateLiteral:
+		return literal{value: token.Value()}, body
+	}
+	return unsupported{text: tokens.Text(token)}, body
+}
+
+type abort struct{}
+
+type evaluation struct {
+	metainfo  meta.Meta
+	record    model.Record
+	entry     *model.Entry
+	variables msg.M
+	config    msg.M
+	history   store.Reader
+	field     string
+	merge     *merge
+	trace     Trace
+	logger    logger
+	today     time.Time
+	idField   string
+	masker    *meta.Masker
+
+	sensitive map[string]string
+}
+
+type logger func(format string, v ...interface{})
+
+type formattedRecord interface {
+	Formats(input string) meta.Formats
+}
+
+func (e *evaluation) formats(input string) meta.Formats {
+	if record, ok := e.record.(formattedRecord); ok {
+		return record.Formats(input)
+	}
+	return meta.Formats{}
+}
+
+func (e *evaluation) fail(err error) {
+	message := err.Error()
+	if conversion, ok := err.(*meta.ConversionError); ok {
+		path, sensitive := e.sensitive[e.field]
+		if !sensitive {
+			path = e.field
+		}
+		message = conversion.Message(e.entry.Mask(path, conversion.Value))
+	}
+	e.entry.Report(message, e.field, model.Fail)
+}
+
+func (e *evaluation) run(p program) {
+	for _, r := range p {
+		e.field = r.field
+		value := r.body.eval(e)
+		if _, ok := value.(abort); ok {
+			if e.entry.Has(model.Skip) {
+				return
+			}
+			continue
+		}
+		if err, ok := value.(error); ok {
+			e.fail(err)
+			continue
+		}
+		if r.token.Type() == tokenizer.Variable {
+			e.variables[r.field] = value
+			continue
+		}
+		if kind := e.metainfo.Type(r.field); kind != meta.Slice && kind != meta.Map {
+			source, _ := r.body.(input)
+			value = e.formats(source.name).Convert(value, kind)
+			if err, ok := value.(error); ok {
+				e.fail(err)
+				continue
+			}
+		}
+		if value == nil {
+			continue
+		}
+		path, err := e.resolvePath(r.field)
+		if err != nil {
+			e.entry.Report(err.Error(), r.field, model.Fail)
+			continue
+		}
+		if err := meta.Set(e.entry.Entity, path, value); err != nil {
+			e.entry.Report(err.Error(), r.field, model.Fail)
+			continue
+		}
+		if e.trace != nil {
+			e.trace[normalizePath(path)] = r.token
+		}
+	}
+}
+
+func (e *evaluation) evalArgs(args []expression) (result []interface{}, stop interface{}) {
+	result = make([]interface{}, len(args))
+	for i, arg := range args {
+		result[i] = arg.eval(e)
+		if isStop(result[i]) {
+			return nil, result[i]
+		}
+	}
+	return result, nil
+}
+
+func isStop(value interface{}) bool {
+	switch value.(type) {
+	case error, abort:
+		return true
+	}
+	return false
+}
+
+var inputSelector = regexp.MustCompile(`\[(\w+)=\$([\w:]+)\]`)
+
+func (e *evaluation) resolvePath(path string) (string, error) {
+	var err error
+	result := inputSelector.ReplaceAllStringFunc(path, func(selector string) string {
+		match := inputSelector.FindStringSubmatch(selector)
+		parts := strings.SplitN(match[2], ":", 2)
+		in := input{name: parts[0]}
+		if len(parts) > 1 {
+			in.kind = parts[1]
+		}
+		value := in.eval(e)
+		if valueErr, ok := value.(error); ok {
+			err = valueErr
+			return selector
+		}
+		if value == nil {
+			err = fmt.Errorf("input '$%s' used as a key of '%s' has no value", in.name, path)
+			return selector
+		}
+		return fmt.Sprintf("[%s=%v]", match[1], value)
+	})
+	return result, err
+}
+
+type Trace map[string]tokenizer.Token
+
+func (t Trace) Rule(path string) (tokenizer.Token, bool) {
+	token, ok := t[normalizePath(path)]
+	return token, ok
+}
+
+func normalizePath(path string) string {
+	var parts []string
+	for _, part := range meta.SplitPath(path) {
+		if name, _, _, keyed := meta.ParseSelector(part); keyed {
+			parts = append(parts, name, meta.UpdateLastElement)
+		} else if _, err := strconv.Atoi(part); err == nil || part == meta.AppendToSlice {
+			parts = append(parts, meta.UpdateLastElement)
+		} else {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,887 @@
+package engine
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/money"
+	"league.com/rulemaker/parser"
+)
+
+type operation struct {
+	minArgs, maxArgs int
+	eval             func(e *evaluation, args []expression) interface{}
+}
+
+var operations map[string]operation
+
+func init() {
+	operations = map[string]operation{
+		"strip_prefix":        {2, 2, stripPrefix},
+		"strip_leading_zeros": {1, 1, stripLeadingZeros},
+		"first_of":            {1, -1, firstOf},
+		"map":                 {2, -1, mapValue},
+		"select":              {3, 3, selectValue},
+		"if":                  {2, 3, ifValue},
+		"cond":                {2, -1, condValue},
+		"case":                {3, -1, caseValue},
+		"all":                 {1, -1, allOf},
+		"any":                 {1, -1, anyOf},
+		"one_of":              {2, -1, oneOf},
+		"join":                {2, -1, join},
+		"+":                   {1, -1, add},
+		"-":                   {2, -1, subtract},
+		"*":                   {1, -1, multiply},
+		"=":                   {2, 2, equal},
+		"!=":                  {2, 2, notEqual},
+		"<":                   {2, 2, less},
+		">":                   {2, 2, greater},
+		"<=":                  {2, 2, lessOrEqual},
+		">=":                  {2, 2, greaterOrEqual},
+		"min":                 {1, -1, minValue},
+		"max":                 {1, -1, maxValue},
+		"has":                 {1, 1, has},
+		"config":              {1, 1, config},
+		"fail":                {0, -1, fail},
+		"log":                 {0, -1, logValues},
+		"ticket":              {0, -1, ticket},
+		"contains":            {2, 2, contains},
+		"skip":                {0, 1, skip},
+		"latest":              {1, 1, latest},
+		"first_of_month":      {1, 1, firstOfMonth},
+		"weekly_hours":        {2, 2, weeklyHours},
+	}
+}
+
+var forms = map[string]parser.Form{
+	"if":   parser.If,
+	"cond": parser.Cond,
+	"case": parser.Case,
+}
+
+func Signatures() map[string]parser.Signature {
+	result := map[string]parser.Signature{}
+	for name, op := range operations {
+		result[name] = parser.Signature{MinArgs: op.minArgs, MaxArgs: op.maxArgs, Form: forms[name]}
+	}
+	return result
+}
+
+func Operations() model.Set {
+	result := model.Set{}
+	for name := range operations {
+		result[name] = struct{}{}
+	}
+	return result
+}
+
+func (c call) checkArity() error {
+	if len(c.args) < c.op.minArgs {
+		return fmt.Errorf("operation '%s' expects at least %d argument(s), got %d", c.name, c.op.minArgs, len(c.args))
+	}
+	if c.op.maxArgs >= 0 && len(c.args) > c.op.maxArgs {
+		return fmt.Errorf("operation '%s' expects at most %d argument(s), got %d", c.name, c.op.maxArgs, len(c.args))
+	}
+	return nil
+}
+
+func stripPrefix(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	if params[0] == nil {
+		return nil
+	}
+	str, prefix := meta.ConvertToString(params[0]), meta.ConvertToString(params[1])
+	if isStop(str) {
+		return str
+	}
+	if isStop(prefix) {
+		return prefix
+	}
+	return strings.TrimPrefix(str.(string), prefix.(string))
+}
+
+func stripLeadingZeros(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	if params[0] == nil {
+		return nil
+	}
+	str := meta.ConvertToString(params[0])
+	if isStop(str) {
+		return str
+	}
+	result := strings.TrimLeft(str.(string), "0")
+	if result == "" && str.(string) != "" {
+		return "0"
+	}
+	return result
+}
+
+func firstOf(e *evaluation, args []expression) interface{} {
+	for _, arg := range args {
+		value := arg.eval(e)
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+func mapValue(e *evaluation, args []expression) interface{} {
+	value := args[0].eval(e)
+	if isStop(value) {
+		return value
+	}
+	pairs := args[1:]
+	for len(pairs) >= 2 {
+		key := pairs[0].eval(e)
+		if isStop(key) {
+			return key
+		}
+		if value != nil && key != nil && fmt.Sprint(key) == fmt.Sprint(value) {
+			return pairs[1].eval(e)
+		}
+		pairs = pairs[2:]
+	}
+	if len(pairs) == 1 {
+		return pairs[0].eval(e)
+	}
+	return nil
+}
+
+func selectValue(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	condition, err := toBool(params[0])
+	if err != nil {
+		return err
+	}
+	if condition {
+		return params[1]
+	}
+	return params[2]
+}
+
+func ifValue(e *evaluation, args []expression) interface{} {
+	condition, stop := evalCondition(e, args[0])
+	if stop != nil {
+		return stop
+	}
+	if condition {
+		return args[1].eval(e)
+	}
+	if len(args) > 2 {
+		return args[2].eval(e)
+	}
+	return nil
+}
+
+func condValue(e *evaluation, args []expression) interface{} {
+	for len(args) >= 2 {
+		condition, stop := evalCondition(e, args[0])
+		if stop != nil {
+			return stop
+		}
+		if condition {
+			return args[1].eval(e)
+		}
+		args = args[2:]
+	}
+	if len(args) == 1 {
+		return args[0].eval(e)
+	}
+	return nil
+}
+
+func caseValue(e *evaluation, args []expression) interface{} {
+	value := args[0].eval(e)
+	if isStop(value) {
+		return value
+	}
+	pairs := args[1:]
+	for len(pairs) >= 2 {
+		key := pairs[0].eval(e)
+		if isStop(key) {
+			return key
+		}
+		matches, err := equalValues(e.formats(""), value, key)
+		if err != nil {
+			return err
+		}
+		if matches {
+			return pairs[1].eval(e)
+		}
+		pairs = pairs[2:]
+	}
+	if len(pairs) == 1 {
+		return pairs[0].eval(e)
+	}
+	return nil
+}
+
+func evalCondition(e *evaluation, arg expression) (bool, interface{}) {
+	value := arg.eval(e)
+	if isStop(value) {
+		return false, value
+	}
+	condition, err := toBool(value)
+	if err != nil {
+		return false, err
+	}
+	return condition, nil
+}
+
+func allOf(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	for _, param := range params {
+		value, err := toBool(param)
+		if err != nil {
+			return err
+		}
+		if !value {
+			return false
+		}
+	}
+	return true
+}
+
+func anyOf(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	for _, param := range params {
+		value, err := toBool(param)
+		if err != nil {
+			return err
+		}
+		if value {
+			return true
+		}
+	}
+	return false
+}
+
+func oneOf(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	params = e.formats("").CommonType(params)
+	if err, ok := params[0].(error); ok {
+		return err
+	}
+	for _, candidate := range params[1:] {
+		if reflect.DeepEqual(params[0], candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func join(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	separator := meta.ConvertToString(params[0])
+	if isStop(separator) {
+		return separator
+	}
+	var parts []string
+	for _, param := range params[1:] {
+		if param == nil {
+			continue
+		}
+		if part := fmt.Sprint(param); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, separator.(string))
+}
+
+func add(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	if result, ok := spanArithmetic(params, false); ok {
+		return result
+	}
+	if slices, ok := entitySlices(params); ok {
+		var result []model.Entity
+		for _, slice := range slices {
+			result = append(result, slice...)
+		}
+		return result
+	}
+	params = e.formats("").CommonType(params)
+	switch firstValue(params).(type) {
+	case error:
+		return params[0]
+	case nil:
+		return nil
+	case string:
+		buf := strings.Builder{}
+		for _, param := range params {
+			if param != nil {
+				buf.WriteString(param.(string))
+			}
+		}
+		return buf.String()
+	case int:
+		result := 0
+		for _, param := range params {
+			if param != nil {
+				result += param.(int)
+			}
+		}
+		return result
+	case float64:
+		result := 0.0
+		for _, param := range params {
+			if param != nil {
+				result += param.(float64)
+			}
+		}
+		return result
+	case money.Amount:
+		var result money.Amount
+		for _, param := range params {
+			if param != nil {
+				result += param.(money.Amount)
+			}
+		}
+		return result
+	}
+	return fmt.Errorf("cannot add values %v", params)
+}
+
+func subtract(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	if result, ok := spanArithmetic(params, true); ok {
+		return result
+	}
+	if one, ok := params[0].(time.Time); ok {
+		two, ok := params[1].(time.Time)
+		if !ok || len(params) > 2 {
+			return fmt.Errorf("cannot subtract '%v' from date '%v'", params[1:], one)
+		}
+		return int(one.Sub(two).Hours() / 24)
+	}
+	params = e.formats("").CommonType(params)
+	switch value := params[0].(type) {
+	case error:
+		return value
+	case nil:
+		return nil
+	case int:
+		for _, param := range params[1:] {
+			if param == nil {
+				return nil
+			}
+			value -= param.(int)
+		}
+		return value
+	case float64:
+		for _, param := range params[1:] {
+			if param == nil {
+				return nil
+			}
+			value -= param.(float64)
+		}
+		return value
+	case time.Duration:
+		for _, param := range params[1:] {
+			if param == nil {
+				return nil
+			}
+			value -= param.(time.Duration)
+		}
+		return value
+	case money.Amount:
+		for _, param := range params[1:] {
+			if param == nil {
+				return nil
+			}
+			value -= param.(money.Amount)
+		}
+		return value
+	}
+	return fmt.Errorf("cannot subtract values '%v'", params)
+}
+
+func spanArithmetic(params []interface{}, negate bool) (interface{}, bool) {
+	var total span
+	spans := 0
+	for _, param := range params[1:] {
+		if param == nil {
+			continue
+		}
+		s, ok := param.(span)
+		if !ok {
+			return nil, false
+		}
+		if negate {
+			s = s.negate()
+		}
+		total = total.plus(s)
+		spans++
+	}
+	if spans == 0 && len(params) > 1 {
+		switch params[0].(type) {
+		case time.Time, span:
+			return nil, true
+		}
+	}
+	switch first := params[0].(type) {
+	case time.Time:
+		return addSpan(first, total), true
+	case span:
+		return first.plus(total), true
+	case nil:
+		return nil, spans > 0
+	}
+	return nil, false
+}
+
+func firstOfMonth(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	switch value := params[0].(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return time.Date(value.Year(), value.Month(), 1, 0, 0, 0, 0, value.Location())
+	}
+	return fmt.Errorf("value '%v' is not a date", params[0])
+}
+
+var periodsPerYear = map[string]float64{
+	"weekly":      52,
+	"biweekly":    26,
+	"semimonthly": 24,
+	"monthly":     12,
+	"quarterly":   4,
+	"annually":    1,
+}
+
+func weeklyHours(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	if params[0] == nil || params[1] == nil {
+		return nil
+	}
+	hours := meta.ConvertToFloat(params[0])
+	if isStop(hours) {
+		return hours
+	}
+	frequency := meta.ConvertToString(params[1])
+	if isStop(frequency) {
+		return frequency
+	}
+	periods, ok := periodsPerYear[strings.ToLower(frequency.(string))]
+	if !ok {
+		return fmt.Errorf("unknown pay frequency '%v'", params[1])
+	}
+	return hours.(float64) * periods / 52
+}
+
+func multiply(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	if amount, factor, ok := moneyFactor(params); ok {
+		if factor == nil {
+			return nil
+		}
+		return amount.Mul(factor)
+	}
+	params = e.formats("").CommonType(params)
+	switch firstValue(params).(type) {
+	case error:
+		return params[0]
+	case nil:
+		return nil
+	case int:
+		result := 1
+		for _, param := range params {
+			if param == nil {
+				return nil
+			}
+			result *= param.(int)
+		}
+		return result
+	case float64:
+		result := 1.0
+		for _, param := range params {
+			if param == nil {
+				return nil
+			}
+			result *= param.(float64)
+		}
+		return result
+	}
+	return fmt.Errorf("cannot multiply values %v", params)
+}
+
+func moneyFactor(params []interface{}) (amount money.Amount, factor *big.Rat, ok bool) {
+	factor = big.NewRat(1, 1)
+	for _, param := range params {
+		switch value := param.(type) {
+		case money.Amount:
+			if ok {
+				return 0, nil, false
+			}
+			amount, ok = value, true
+		case int:
+			factor.Mul(factor, big.NewRat(int64(value), 1))
+		case float64:
+			factor.Mul(factor, new(big.Rat).SetFloat64(value))
+		case nil:
+			return 0, nil, true
+		default:
+			return 0, nil, false
+		}
+	}
+	return amount, factor, ok
+}
+
+func equal(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	result, err := equalValues(e.formats(""), params[0], params[1])
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func equalValues(formats meta.Formats, one, two interface{}) (bool, error) {
+	params := formats.CommonType([]interface{}{one, two})
+	if err, ok := params[0].(error); ok {
+		return false, err
+	}
+	return reflect.DeepEqual(params[0], params[1]), nil
+}
+
+func notEqual(e *evaluation, args []expression) interface{} {
+	result := equal(e, args)
+	if value, ok := result.(bool); ok {
+		return !value
+	}
+	return result
+}
+
+func less(e *evaluation, args []expression) interface{} {
+	return compareWith(e, args, func(order int) bool { return order < 0 })
+}
+
+func greater(e *evaluation, args []expression) interface{} {
+	return compareWith(e, args, func(order int) bool { return order > 0 })
+}
+
+func lessOrEqual(e *evaluation, args []expression) interface{} {
+	return compareWith(e, args, func(order int) bool { return order <= 0 })
+}
+
+func greaterOrEqual(e *evaluation, args []expression) interface{} {
+	return compareWith(e, args, func(order int) bool { return order >= 0 })
+}
+
+func compareWith(e *evaluation, args []expression, test func(order int) bool) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	if params[0] == nil || params[1] == nil {
+		return false
+	}
+	order, err := e.formats("").Compare(params[0], params[1])
+	if err != nil {
+		return err
+	}
+	return test(order)
+}
+
+func minValue(e *evaluation, args []expression) interface{} {
+	return pick(e, args, func(order int) bool { return order < 0 })
+}
+
+func maxValue(e *evaluation, args []expression) interface{} {
+	return pick(e, args, func(order int) bool { return order > 0 })
+}
+
+func pick(e *evaluation, args []expression, better func(order int) bool) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	var result interface{}
+	for _, param := range params {
+		if param == nil {
+			continue
+		}
+		if result == nil {
+			result = param
+			continue
+		}
+		order, err := e.formats("").Compare(param, result)
+		if err != nil {
+			return err
+		}
+		if better(order) {
+			result = param
+		}
+	}
+	return result
+}
+
+func has(e *evaluation, args []expression) interface{} {
+	value := args[0].eval(e)
+	if isStop(value) {
+		return value
+	}
+	if value == nil {
+		return false
+	}
+	if str, ok := value.(string); ok {
+		return str != ""
+	}
+	return true
+}
+
+func config(e *evaluation, args []expression) interface{} {
+	key := args[0].eval(e)
+	if isStop(key) {
+		return key
+	}
+	return e.config[fmt.Sprint(key)]
+}
+
+func fail(e *evaluation, args []expression) interface{} {
+	return report(e, args, model.Fail)
+}
+
+func ticket(e *evaluation, args []expression) interface{} {
+	return report(e, args, model.Ticket)
+}
+
+func skip(e *evaluation, args []expression) interface{} {
+	return report(e, args, model.Skip)
+}
+
+func report(e *evaluation, args []expression, action model.Action) interface{} {
+	message, stop := e.message(args)
+	if stop != nil {
+		return stop
+	}
+	e.entry.Report(message, e.field, action)
+	if action == model.Ticket {
+		return nil
+	}
+	return abort{}
+}
+
+func logValues(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	message := fmt.Sprintln(e.maskArgs(args, params)...)
+	if e.logger != nil {
+		e.logger("%s: %s", e.field, message)
+	}
+	e.entry.Report(strings.TrimSpace(message), e.field, model.Log)
+	if len(params) == 0 {
+		return nil
+	}
+	return params[len(params)-1]
+}
+
+func contains(e *evaluation, args []expression) interface{} {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return stop
+	}
+	if params[0] == nil {
+		return false
+	}
+	str, substr := meta.ConvertToString(params[0]), meta.ConvertToString(params[1])
+	if isStop(str) {
+		return str
+	}
+	if isStop(substr) {
+		return substr
+	}
+	return strings.Contains(str.(string), substr.(string))
+}
+
+func latest(e *evaluation, args []expression) interface{} {
+	if e.merge == nil {
+		return fmt.Errorf("operation 'latest' is only available in merging rules")
+	}
+	dateField, ok := args[0].(field)
+	if !ok {
+		return fmt.Errorf("operation 'latest' expects a date field")
+	}
+	oldDate := e.formats("").Convert(meta.Get(e.merge.old, dateField.path), meta.Date)
+	newDate := e.formats("").Convert(meta.Get(e.merge.new, dateField.path), meta.Date)
+	if err, ok := oldDate.(error); ok {
+		return err
+	}
+	if err, ok := newDate.(error); ok {
+		return err
+	}
+	newValue, _ := e.merge.lookup(newValueVariable, e.field)
+	oldValue, _ := e.merge.lookup(oldValueVariable, e.field)
+	if newDate == nil && oldDate != nil {
+		return oldValue
+	}
+	if newDate != nil && oldDate != nil && newDate.(time.Time).Before(oldDate.(time.Time)) {
+		return oldValue
+	}
+	return newValue
+}
+
+func (e *evaluation) message(args []expression) (string, interface{}) {
+	params, stop := e.evalArgs(args)
+	if stop != nil {
+		return "", stop
+	}
+	return strings.TrimSpace(fmt.Sprintln(e.maskArgs(args, params)...)), nil
+}
+
+func (e *evaluation) maskArgs(args []expression, params []interface{}) []interface{} {
+	result := make([]interface{}, len(params))
+	for i, param := range params {
+		result[i] = param
+		if path, ok := e.sensitivePath(args[i]); ok {
+			result[i] = e.masker.Value(path, param)
+		}
+	}
+	return result
+}
+
+func (e *evaluation) sensitivePath(arg expression) (string, bool) {
+	switch arg := arg.(type) {
+	case field:
+		return arg.path, true
+	case input:
+		path, ok := e.sensitive["$"+arg.name]
+		return path, ok
+	case variable:
+		if path, ok := e.sensitive[arg.name]; ok {
+			return path, true
+		}
+		for _, name := range []string{oldValueVariable, newValueVariable, previousValueVariable} {
+			if arg.name == name {
+				return e.field, true
+			}
+			if strings.HasPrefix(arg.name, name+".") {
+				return arg.name[len(name)+1:], true
+			}
+		}
+	}
+	return "", false
+}
+
+func sensitiveSources(p program, masker *meta.Masker) map[string]string {
+	result := map[string]string{}
+	var collect func(path string, expr expression) bool
+	collect = func(path string, expr expression) bool {
+		var name string
+		switch expr := expr.(type) {
+		case input:
+			name = "$" + expr.name
+		case variable:
+			name = expr.name
+		case call:
+			changed := false
+			for _, arg := range expr.args {
+				changed = collect(path, arg) || changed
+			}
+			return changed
+		default:
+			return false
+		}
+		if _, ok := result[name]; ok {
+			return false
+		}
+		result[name] = path
+		return true
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, r := range p {
+			path, ok := r.field, masker.Sensitive(r.field)
+			if !ok {
+				path, ok = result[r.field]
+			}
+			if ok && collect(path, r.body) {
+				changed = true
+			}
+		}
+	}
+	return result
+}
+
+func firstValue(params []interface{}) interface{} {
+	for _, param := range params {
+		if param != nil {
+			return param
+		}
+	}
+	return nil
+}
+
+func toBool(value interface{}) (bool, error) {
+	if value == nil {
+		return false, nil
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("value '%v' is not a boolean", value)
+	}
+	return result, nil
+}
+
+func entitySlices(params []interface{}) ([][]model.Entity, bool) {
+	result := make([][]model.Entity, 0, len(params))
+	for _, param := range params {
+		if param == nil {
+			continue
+		}
+		slice, ok := param.([]model.Entity)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, slice)
+	}
+	return result, len(result) > 0
+}
@@ -0,0 +1,153 @@
+package lifecycle
+
+import (
+	"fmt"
+	"time"
+
+	"league.com/rulemaker/canonical_model"
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+)
+
+const (
+	stateField                   = "state"
+	stateEffectiveDateField      = "state_effective_date"
+	onReinstateField             = "on_reinstate"
+	benefitClassField            = "benefit_class"
+	onBenefitClassChangeField    = "on_benefit_class_change"
+	benefitClassChangeDateField  = "benefit_class_change_effective_date"
+	noState                      = canonical_model.State("")
+	defaultBackdateToleranceDays = 30
+)
+
+type Transition struct {
+	From, To canonical_model.State
+}
+
+func (t Transition) String() string {
+	from := t.From
+	if from == noState {
+		from = "new"
+	}
+	return fmt.Sprintf("%s -> %s", from, t.To)
+}
+
+type Lifecycle struct {
+	Transitions           map[Transition]model.Action
+	BackdateToleranceDays int
+	Today                 time.Time
+}
+
+func NewLifecycle() *Lifecycle {
+	now := time.Now()
+	return &Lifecycle{
+		Transitions: map[Transition]model.Action{
+			{noState, canonical_model.StateActive}:                             model.None,
+			{noState, canonical_model.StateIneligible}:                         model.None,
+			{noState, canonical_model.StateTerminated}:                         model.Alert,
+			{canonical_model.StateActive, canonical_model.StateTerminated}:     model.None,
+			{canonical_model.StateActive, canonical_model.StateIneligible}:     model.None,
+			{canonical_model.StateIneligible, canonical_model.StateActive}:     model.None,
+			{canonical_model.StateIneligible, canonical_model.StateTerminated}: model.None,
+			{canonical_model.StateTerminated, canonical_model.StateActive}:     model.None,
+			{canonical_model.StateTerminated, canonical_model.StateIneligible}: model.Fail,
+			{canonical_model.StateActive, canonical_model.StateActive}:         model.None,
+			{canonical_model.StateIneligible, canonical_model.StateIneligible}: model.None,
+			{canonical_model.StateTerminated, canonical_model.StateTerminated}: model.None,
+		},
+		BackdateToleranceDays: defaultBackdateToleranceDays,
+		Today:                 time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (l *Lifecycle) Process(previous, current model.Entries) {
+	for id, entry := range current {
+		var previousEntity model.Entity
+		if previousEntry, ok := previous[id]; ok {
+			previousEntity = previousEntry.Entity
+		}
+		l.Check(previousEntity, entry)
+	}
+}
+
+func (l *Lifecycle) Check(previous model.Entity, current *model.Entry) {
+	l.checkState(previous, current)
+	l.checkBenefitClass(previous, current)
+}
+
+func (l *Lifecycle) checkState(previous model.Entity, current *model.Entry) {
+	to := state(current.Entity)
+	if to == noState {
+		return
+	}
+	from := state(previous)
+	transition := Transition{From: from, To: to}
+	action, legal := l.Transitions[transition]
+	if !legal {
+		current.Report(fmt.Sprintf("Illegal state transition %s", transition), stateField, model.Fail)
+		return
+	}
+	if action != model.None {
+		current.Report(fmt.Sprintf("Suspicious state transition %s", transition), stateField, action)
+	}
+
+	effectiveDate := date(current.Entity, stateEffectiveDateField)
+	previousEffectiveDate := date(previous, stateEffectiveDateField)
+	if from != to && from != noState && effectiveDate == nil {
+		current.Report(fmt.Sprintf("State transition %s has no %s", transition, stateEffectiveDateField), stateEffectiveDateField, model.Ticket)
+	}
+	if from == to && to == canonical_model.StateTerminated && effectiveDate != nil && previousEffectiveDate != nil && !effectiveDate.Equal(*previousEffectiveDate) {
+		current.Report(fmt.Sprintf("Termination date changed from %s to %s", previousEffectiveDate.Format("2006-01-02"), effectiveDate.Format("2006-01-02")), stateEffectiveDateField, model.Alert)
+	}
+	if from == canonical_model.StateTerminated && to == canonical_model.StateActive {
+		if onReinstate, _ := current.Entity[onReinstateField].(string); onReinstate == "" {
+			current.Report(fmt.Sprintf("Reinstating terminated employee without %s", onReinstateField), onReinstateField, model.Ticket)
+		}
+	}
+	if to != canonical_model.StateTerminated || from == to || effectiveDate == nil {
+		return
+	}
+	if previousEffectiveDate != nil && effectiveDate.Before(*previousEffectiveDate) {
+		current.Report(fmt.Sprintf("Termination date %s is before the previous state effective date %s", effectiveDate.Format("2006-01-02"), previousEffectiveDate.Format("2006-01-02")), stateEffectiveDateField, model.Alert)
+	} else if days := int(l.Today.Sub(*effectiveDate).Hours() / 24); days > l.BackdateToleranceDays {
+		current.Report(fmt.Sprintf("Termination is backdated by %d days", days), stateEffectiveDateField, model.Alert)
+	}
+}
+
+func (l *Lifecycle) checkBenefitClass(previous model.Entity, current *model.Entry) {
+	from, _ := previous[benefitClassField].(string)
+	to, _ := current.Entity[benefitClassField].(string)
+	if from == "" || to == "" || from == to {
+		return
+	}
+	if onChange, _ := current.Entity[onBenefitClassChangeField].(string); onChange == "" {
+		current.Report(fmt.Sprintf("Benefit class changed from '%s' to '%s' without %s", from, to, onBenefitClassChangeField), onBenefitClassChangeField, model.Ticket)
+	}
+	if changeDate := date(current.Entity, benefitClassChangeDateField); changeDate == nil {
+		current.Report(fmt.Sprintf("Benefit class changed from '%s' to '%s' without %s", from, to, benefitClassChangeDateField), benefitClassChangeDateField, model.Ticket)
+	} else if days := int(l.Today.Sub(*changeDate).Hours() / 24); days > l.BackdateToleranceDays {
+		current.Report(fmt.Sprintf("Benefit class change is backdated by %d days", days), benefitClassChangeDateField, model.Alert)
+	}
+}
+
+func state(entity model.Entity) canonical_model.State {
+	switch value := entity[stateField].(type) {
+	case string:
+		return canonical_model.State(value)
+	case canonical_model.State:
+		return value
+	}
+	return noState
+}
+
+func date(entity model.Entity, field string) *time.Time {
+	value := entity[field]
+	if value == nil {
+		return nil
+	}
+	result, ok := meta.ConvertToDate(value).(time.Time)
+	if !ok || result.IsZero() {
+		return nil
+	}
+	return &result
+}
@@ -0,0 +1,87 @@
+package lifecycle
+
+import (
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"league.com/rulemaker/model"
+)
+
+func TestCheck(t *testing.T) {
+	l := NewLifecycle()
+	l.Today = time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, test := range fixture {
+		entry := &model.Entry{Entity: test.current}
+		l.Check(test.previous, entry)
+		var got []model.Action
+		for _, d := range entry.Diagnostics {
+			got = append(got, d.Action)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			log.Println("fixture  ", i)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", entry.Diagnostics)
+			t.FailNow()
+		}
+	}
+}
+
+var fixture = []struct {
+	previous model.Entity
+	current  model.Entity
+	expected []model.Action
+}{
+	{nil, model.Entity{"state": "active"}, nil},
+	{nil, model.Entity{"state": "terminated"}, []model.Action{model.Alert}},
+	{model.Entity{"state": "active"}, model.Entity{"state": "active"}, nil},
+	{model.Entity{"state": "active"}, model.Entity{"state": "retired"}, []model.Action{model.Fail}},
+	{model.Entity{"state": "terminated"}, model.Entity{"state": "ineligible", "state_effective_date": "2020-02-20"}, []model.Action{model.Fail}},
+	{
+		model.Entity{"state": "active"},
+		model.Entity{"state": "terminated", "state_effective_date": "2020-02-20"},
+		nil,
+	},
+	{
+		model.Entity{"state": "active"},
+		model.Entity{"state": "terminated"},
+		[]model.Action{model.Ticket},
+	},
+	{
+		model.Entity{"state": "active", "state_effective_date": "2019-01-01"},
+		model.Entity{"state": "terminated", "state_effective_date": "2019-06-01"},
+		[]model.Action{model.Alert},
+	},
+	{
+		model.Entity{"state": "active", "state_effective_date": "2020-01-01"},
+		model.Entity{"state": "terminated", "state_effective_date": "2019-12-01"},
+		[]model.Action{model.Alert},
+	},
+	{
+		model.Entity{"state": "terminated", "state_effective_date": "2020-01-01"},
+		model.Entity{"state": "terminated", "state_effective_date": "2020-01-15"},
+		[]model.Action{model.Alert},
+	},
+	{
+		model.Entity{"state": "terminated"},
+		model.Entity{"state": "active", "state_effective_date": "2020-02-20"},
+		[]model.Action{model.Ticket},
+	},
+	{
+		model.Entity{"state": "terminated"},
+		model.Entity{"state": "active", "state_effective_date": "2020-02-20", "on_reinstate": "rehire"},
+		nil,
+	},
+	{
+		model.Entity{"state": "active", "benefit_class": "A"},
+		model.Entity{"state": "active", "benefit_class": "B"},
+		[]model.Action{model.Ticket, model.Ticket},
+	},
+	{
+		model.Entity{"state": "active", "benefit_class": "A"},
+		model.Entity{"state": "active", "benefit_class": "B", "on_benefit_class_change": "reenroll", "benefit_class_change_effective_date": "2020-02-01"},
+		nil,
+	},
+}
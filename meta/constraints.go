@@ -0,0 +1,137 @@
+package meta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"league.com/rulemaker/model"
+)
+
+const RequiredOperator = "required" // localizer.Ignore
+
+var constraintOperators = map[string]struct {
+	test   func(order int) bool
+	phrase string
+}{
+	"=":  {func(order int) bool { return order == 0 }, "equal to"},       // localizer.Ignore
+	"!=": {func(order int) bool { return order != 0 }, "different from"}, // localizer.Ignore
+	"<":  {func(order int) bool { return order < 0 }, "before"},          // localizer.Ignore
+	"<=": {func(order int) bool { return order <= 0 }, "on or before"},   // localizer.Ignore
+	">":  {func(order int) bool { return order > 0 }, "after"},           // localizer.Ignore
+	">=": {func(order int) bool { return order >= 0 }, "on or after"},    // localizer.Ignore
+}
+
+func RequiredConstraints(required model.Set) (result model.Constraints) {
+	fields := make([]string, 0, len(required))
+	for field := range required {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		result = append(result, model.Constraint{Name: "required_" + field, Field: field, Operator: RequiredOperator}) // localizer.Ignore
+	}
+	return result
+}
+
+func ReadConstraints(path string) (model.Constraints, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var result model.Constraints
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err) // localizer.Ignore
+	}
+	return result, nil
+}
+
+func ConstraintsForModel(constraints model.Constraints, name string, metainfo Meta) (result model.Constraints) {
+	for _, constraint := range constraints {
+		if constraint.Model == name || constraint.Model == "" && metainfo.Type(constraint.Field) != Invalid && (constraint.Other == "" || metainfo.Type(constraint.Other) != Invalid) {
+			result = append(result, constraint)
+		}
+	}
+	return result
+}
+
+func PrepareConstraints(constraints model.Constraints, metainfo Meta) error {
+	names := model.Set{}
+	for i, constraint := range constraints {
+		if constraint.Name == "" {
+			return fmt.Errorf("constraint on '%s' has no name", constraint.Field) // localizer.Ignore
+		}
+		if _, ok := names[constraint.Name]; ok {
+			return fmt.Errorf("constraint '%s' is defined more than once", constraint.Name) // localizer.Ignore
+		}
+		names[constraint.Name] = struct{}{}
+		if constraint.Action == "" {
+			constraints[i].Action = model.Log
+		}
+		fields := []string{constraint.Field}
+		if _, ok := constraintOperators[constraint.Operator]; ok {
+			fields = append(fields, constraint.Other)
+		} else if constraint.Operator != RequiredOperator {
+			return fmt.Errorf("constraint '%s': unknown operator '%s'", constraint.Name, constraint.Operator) // localizer.Ignore
+		}
+		for _, field := range fields {
+			if metainfo.Type(field) == Invalid {
+				return fmt.Errorf("constraint '%s': canonical model does not have field '%s'", constraint.Name, field) // localizer.Ignore
+			}
+		}
+	}
+	return nil
+}
+
+func CheckConstraints(constraints model.Constraints, entry *model.Entry) {
+	for _, constraint := range constraints {
+		if constraint.Operator == RequiredOperator {
+			if value := Get(entry.Entity, constraint.Field); value == nil || value == "" {
+				entry.Violate(constraint, fmt.Sprintf("%s: '%s' is required", constraint.Name, constraint.Field), constraint.Field) // localizer.Ignore
+			}
+			continue
+		}
+		operator := constraintOperators[constraint.Operator]
+		for _, field := range expandPath(entry.Entity, constraint.Field) {
+			value := Get(entry.Entity, field)
+			if value == nil {
+				continue
+			}
+			for _, other := range expandPath(entry.Entity, alignPath(constraint.Field, constraint.Other, field)) {
+				otherValue := Get(entry.Entity, other)
+				if otherValue == nil {
+					continue
+				}
+				shown, otherShown := formatValue(entry.Mask(field, value)), formatValue(entry.Mask(other, otherValue))
+				order, err := Compare(value, otherValue)
+				if err != nil {
+					entry.Violate(constraint, fmt.Sprintf("%s: cannot compare values '%s' and '%s'", constraint.Name, shown, otherShown), field) // localizer.Ignore
+				} else if !operator.test(order) {
+					entry.Violate(constraint, fmt.Sprintf("%s: %s %s must be %s %s %s", constraint.Name, field, shown, operator.phrase, other, otherShown), field) // localizer.Ignore
+				}
+			}
+		}
+	}
+}
+
+func alignPath(field, other, expanded string) string {
+	parts := SplitPath(field)
+	otherParts := SplitPath(other)
+	concrete := SplitPath(expanded)
+	for i := 0; i < len(parts) && i < len(otherParts) && i < len(concrete) && parts[i] == otherParts[i]; i++ {
+		if parts[i] == AppendToSlice {
+			otherParts[i] = concrete[i]
+		}
+	}
+	return strings.Join(otherParts, ".")
+}
+
+func formatValue(value interface{}) string {
+	if date, ok := value.(time.Time); ok {
+		return date.Format("2006-01-02")
+	}
+	return fmt.Sprint(value)
+}
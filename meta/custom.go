@@ -0,0 +1,81 @@
+package meta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+var typeNames = map[string]Type{
+	"bool":     Bool,
+	"int":      Int,
+	"float":    Float,
+	"string":   String,
+	"date":     Date,
+	"duration": Duration,
+	"money":    Money,
+	"map":      Map,
+}
+
+func ParseType(name string) (Type, error) {
+	if kind, ok := typeNames[strings.ToLower(name)]; ok {
+		return kind, nil
+	}
+	return Invalid, fmt.Errorf("unknown type '%s'", name) // localizer.Ignore
+}
+
+func ReadSchema(path string) (Meta, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(bytes, &fields); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err) // localizer.Ignore
+	}
+	result := Meta{}
+	if err := collectSchema(fields, "", result); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err) // localizer.Ignore
+	}
+	return result, nil
+}
+
+func collectSchema(fields map[string]interface{}, path string, result Meta) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch value := fields[name].(type) {
+		case string:
+			kind, err := ParseType(value)
+			if err != nil {
+				return fmt.Errorf("field '%s%s': %v", path, name, err) // localizer.Ignore
+			}
+			result[path+name] = kind
+		case map[string]interface{}:
+			if err := collectSchema(value, path+name+".", result); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("field '%s%s': expected a type name or an object", path, name) // localizer.Ignore
+		}
+	}
+	return nil
+}
+
+func (m Meta) WithSchema(root string, schema Meta) Meta {
+	result := Meta{}
+	for field, kind := range m {
+		if field != root+"."+EntityMap {
+			result[field] = kind
+		}
+	}
+	for field, kind := range schema {
+		result[root+"."+field] = kind
+	}
+	return result
+}
@@ -0,0 +1,289 @@
+package meta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/msg"
+)
+
+const (
+	jsonSchemaVersion = "http://json-schema.org/draft-07/schema#" // localizer.Ignore
+	idFieldKeyword    = "x-id-field"                              // localizer.Ignore
+	typeKeyword       = "x-type"                                  // localizer.Ignore
+	sensitiveKeyword  = "x-sensitive"                             // localizer.Ignore
+)
+
+type schemaNode struct {
+	path     string
+	kind     Type
+	children map[string]*schemaNode
+}
+
+func (m Model) JSONSchema() msg.M {
+	root := &schemaNode{children: map[string]*schemaNode{}}
+	for field, kind := range m.Metainfo {
+		parts := strings.Split(field, ".")
+		if contains(parts, UpdateLastElement) {
+			continue
+		}
+		node := root
+		for i, part := range parts {
+			child, ok := node.children[part]
+			if !ok {
+				child = &schemaNode{path: strings.Join(parts[:i+1], "."), children: map[string]*schemaNode{}}
+				node.children[part] = child
+			}
+			node = child
+		}
+		node.kind = kind
+	}
+
+	result := m.schemaOf(root)
+	result["$schema"] = jsonSchemaVersion
+	if m.Name != "" {
+		result["title"] = m.Name
+	}
+	if m.IdField != "" {
+		result[idFieldKeyword] = m.IdField
+	}
+	required := []string{}
+	for name := range m.Required {
+		if _, ok := root.children[name]; ok {
+			required = append(required, name)
+		}
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		result["required"] = required
+	}
+	return result
+}
+
+func (m Model) schemaOf(node *schemaNode) msg.M {
+	var result msg.M
+	if items, ok := node.children[AppendToSlice]; ok {
+		result = msg.M{"type": "array", "items": m.schemaOf(items)} // localizer.Ignore
+	} else if values, ok := node.children[EntityMap]; ok {
+		result = msg.M{"type": "object", "additionalProperties": m.schemaOf(values)} // localizer.Ignore
+	} else if len(node.children) > 0 {
+		properties := msg.M{}
+		for name, child := range node.children {
+			properties[name] = m.schemaOf(child)
+		}
+		result = msg.M{"type": "object", "properties": properties} // localizer.Ignore
+	} else {
+		result = leafSchema(node.kind)
+	}
+	if _, ok := m.Nullable[node.path]; ok {
+		if kind, ok := result["type"].(string); ok {
+			result["type"] = []string{kind, "null"} // localizer.Ignore
+		}
+	}
+	if _, ok := m.Sensitive[node.path]; ok {
+		result[sensitiveKeyword] = true
+	}
+	return result
+}
+
+func leafSchema(kind Type) msg.M {
+	switch kind {
+	case Bool:
+		return msg.M{"type": "boolean"} // localizer.Ignore
+	case Int:
+		return msg.M{"type": "integer"} // localizer.Ignore
+	case Float:
+		return msg.M{"type": "number"} // localizer.Ignore
+	case String:
+		return msg.M{"type": "string"} // localizer.Ignore
+	case Date:
+		return msg.M{"type": "string", "format": "date-time"} // localizer.Ignore
+	case Duration:
+		return msg.M{"type": "integer", typeKeyword: "duration"} // localizer.Ignore
+	case Money:
+		return msg.M{"type": "number", typeKeyword: "money"} // localizer.Ignore
+	case Slice:
+		return msg.M{"type": "array"} // localizer.Ignore
+	}
+	return msg.M{}
+}
+
+func ReadJSONSchema(path string) (Model, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Model{}, err
+	}
+	var schema msg.M
+	if err := json.Unmarshal(bytes, &schema); err != nil {
+		return Model{}, fmt.Errorf("%s: %v", path, err) // localizer.Ignore
+	}
+	result, err := ParseJSONSchema(schema)
+	if err != nil {
+		return Model{}, fmt.Errorf("%s: %v", path, err) // localizer.Ignore
+	}
+	if result.Name == "" {
+		result.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return result, nil
+}
+
+func ParseJSONSchema(schema msg.M) (Model, error) {
+	result := Model{Metainfo: Meta{}, Required: model.Set{}, Nullable: model.Set{}, Sensitive: model.Set{}}
+	result.Name, _ = schema["title"].(string)
+	result.IdField, _ = schema[idFieldKeyword].(string)
+	properties, _ := schema["properties"].(map[string]interface{})
+	if properties == nil {
+		return result, fmt.Errorf("the schema does not describe an object with properties") // localizer.Ignore
+	}
+	switch required := schema["required"].(type) {
+	case []string:
+		for _, name := range required {
+			result.Required[name] = struct{}{}
+		}
+	case []interface{}:
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				result.Required[name] = struct{}{}
+			}
+		}
+	}
+	for _, name := range sortedKeys(properties) {
+		if err := result.collectJSONSchema(properties[name], name); err != nil {
+			return result, err
+		}
+	}
+	result.Constraints = RequiredConstraints(result.Required)
+	if result.IdField == "" {
+		return result, fmt.Errorf("the schema does not declare its id field with '%s'", idFieldKeyword) // localizer.Ignore
+	}
+	if result.Metainfo.Type(result.IdField) == Invalid {
+		return result, fmt.Errorf("id field '%s' is not a property", result.IdField) // localizer.Ignore
+	}
+	return result, nil
+}
+
+func (m Model) collectJSONSchema(value interface{}, path string) error {
+	schema, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("field '%s': expected an object", path) // localizer.Ignore
+	}
+	kind, nullable, err := schemaType(schema["type"])
+	if err != nil {
+		return fmt.Errorf("field '%s': %v", path, err) // localizer.Ignore
+	}
+	if nullable {
+		m.Nullable[path] = struct{}{}
+	}
+	if sensitive, _ := schema[sensitiveKeyword].(bool); sensitive && !contains(strings.Split(path, "."), UpdateLastElement) {
+		m.Sensitive[path] = struct{}{}
+	}
+	extension, _ := schema[typeKeyword].(string)
+	switch kind {
+	case "":
+		m.Metainfo[path] = Map
+	case "object":
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, name := range sortedKeys(properties) {
+			if err := m.collectJSONSchema(properties[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+		if values, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			return m.collectJSONSchema(values, path+"."+EntityMap)
+		}
+		if len(properties) == 0 {
+			m.Metainfo[path+"."+EntityMap] = Map
+		}
+	case "array":
+		m.Metainfo[path] = Slice
+		if items, ok := schema["items"]; ok {
+			if err := m.collectJSONSchema(items, path+"."+AppendToSlice); err != nil {
+				return err
+			}
+			return m.collectJSONSchema(items, path+"."+UpdateLastElement)
+		}
+	case "string":
+		switch format, _ := schema["format"].(string); {
+		case format == "date" || format == "date-time":
+			m.Metainfo[path] = Date
+		case extension != "":
+			return m.setExtension(path, extension)
+		default:
+			m.Metainfo[path] = String
+		}
+	case "integer", "number":
+		if extension != "" {
+			return m.setExtension(path, extension)
+		}
+		m.Metainfo[path] = Float
+		if kind == "integer" {
+			m.Metainfo[path] = Int
+		}
+	case "boolean":
+		m.Metainfo[path] = Bool
+	default:
+		return fmt.Errorf("field '%s': unsupported type '%s'", path, kind) // localizer.Ignore
+	}
+	return nil
+}
+
+func (m Model) setExtension(path, name string) error {
+	kind, err := ParseType(name)
+	if err != nil {
+		return fmt.Errorf("field '%s': %v", path, err) // localizer.Ignore
+	}
+	m.Metainfo[path] = kind
+	return nil
+}
+
+func schemaType(value interface{}) (kind string, nullable bool, err error) {
+	switch value := value.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return value, value == "null", nil
+	case []string:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = item
+		}
+		return schemaType(items)
+	case []interface{}:
+		for _, item := range value {
+			name, _ := item.(string)
+			switch {
+			case name == "null":
+				nullable = true
+			case kind == "":
+				kind = name
+			default:
+				return "", false, fmt.Errorf("more than one type") // localizer.Ignore
+			}
+		}
+		return kind, nullable, nil
+	}
+	return "", false, fmt.Errorf("invalid type") // localizer.Ignore
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func contains(parts []string, part string) bool {
+	for _, p := range parts {
+		if p == part {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package meta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"league.com/rulemaker/model"
+)
+
+type MaskMode int
+
+const (
+	Masked MaskMode = iota
+	Hashed
+	Unmasked
+)
+
+func ParseMaskMode(name string) (MaskMode, error) {
+	switch name {
+	case "mask":
+		return Masked, nil
+	case "hash":
+		return Hashed, nil
+	case "none":
+		return Unmasked, nil
+	}
+	return Masked, fmt.Errorf("unknown mask mode '%s', expected mask, hash or none", name) // localizer.Ignore
+}
+
+type Masker struct {
+	sensitive model.Set
+	mode      MaskMode
+}
+
+func NewMasker(sensitive model.Set, mode MaskMode) *Masker {
+	return &Masker{sensitive: sensitive, mode: mode}
+}
+
+func (m *Masker) Sensitive(field string) bool {
+	if m == nil || m.mode == Unmasked || len(m.sensitive) == 0 {
+		return false
+	}
+	var parts []string
+	for _, part := range SplitPath(field) {
+		if name, _, _, keyed := ParseSelector(part); keyed {
+			parts = append(parts, name, AppendToSlice)
+		} else if _, err := strconv.Atoi(part); err == nil || part == UpdateLastElement {
+			parts = append(parts, AppendToSlice)
+		} else {
+			parts = append(parts, part)
+		}
+	}
+	for i := range parts {
+		if _, ok := m.sensitive[strings.Join(parts[:i+1], ".")]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Masker) Value(field string, value interface{}) interface{} {
+	if value == nil || !m.Sensitive(field) {
+		return value
+	}
+	return m.mask(value)
+}
+
+func (m *Masker) mask(value interface{}) string {
+	text := fmt.Sprint(value)
+	if date, ok := value.(time.Time); ok {
+		text = date.Format("2006-01-02")
+	}
+	if m.mode == Hashed {
+		sum := sha256.Sum256([]byte(text))
+		return "sha256:" + hex.EncodeToString(sum[:6]) // localizer.Ignore
+	}
+	runes := []rune(text)
+	visible := 0
+	if _, err := ParseDate(text, DefaultDateFormats); err != nil && len(runes) >= 6 {
+		if _, ok := value.(string); ok {
+			visible = 3
+		}
+	}
+	return strings.Repeat("*", len(runes)-visible) + string(runes[len(runes)-visible:])
+}
+
+func (m *Masker) Entity(entity model.Entity) model.Entity {
+	if m == nil || m.mode == Unmasked {
+		return entity
+	}
+	masked, _ := m.maskValue("", entity).(model.Entity)
+	return masked
+}
+
+func (m *Masker) Entries(entries model.Entries) model.Entries {
+	if m == nil || m.mode == Unmasked {
+		return entries
+	}
+	result := make(model.Entries, len(entries))
+	for id, entry := range entries {
+		masked := *entry
+		masked.Entity = m.Entity(entry.Entity)
+		result[id] = &masked
+	}
+	return result
+}
+
+func (m *Masker) maskValue(path string, value interface{}) interface{} {
+	if path != "" && m.Sensitive(path) {
+		if value == nil {
+			return nil
+		}
+		switch value.(type) {
+		case model.Entity, []model.Entity, map[string]interface{}, []interface{}:
+		default:
+			return m.mask(value)
+		}
+	}
+	switch value := value.(type) {
+	case model.Entity:
+		result := model.Entity{}
+		for key, element := range value {
+			result[key] = m.maskValue(joinPath(path, key), element)
+		}
+		return result
+	case []model.Entity:
+		result := make([]model.Entity, len(value))
+		for i, element := range value {
+			result[i], _ = m.maskValue(joinPath(path, AppendToSlice), element).(model.Entity)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, element := range value {
+			result[i] = m.maskValue(joinPath(path, AppendToSlice), element)
+		}
+		return result
+	}
+	return value
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
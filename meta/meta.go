@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"league.com/rulemaker/model"
+	"league.com/rulemaker/money"
 	"league.com/rulemaker/util"
 )
 
@@ -29,6 +30,7 @@ const (
 	Duration
 	Map
 	Slice
+	Money
 )
 
 func (t Type) String() string {
@@ -49,6 +51,8 @@ func (t Type) String() string {
 		return "Duration" // localizer.Ignore
 	case Map:
 		return "Map" // localizer.Ignore
+	case Money:
+		return "Money" // localizer.Ignore
 	}
 	return "Unknown Type" // localizer.Ignore
 }
@@ -64,17 +68,34 @@ func Metainfo(entity interface{}) (result Meta) {
 	meta := deref(reflect.TypeOf(entity))
 	for i := 0; i < meta.NumField(); i++ {
 		field := meta.Field(i)
-		collectMetainfo(field.Type, fieldName(field), result)
+		collectMetainfo(field.Type, fieldName(field), result, model.Set{})
 	}
 
 	return result
 }
 
+func Nullable(entity interface{}) model.Set {
+	result := model.Set{}
+	meta := deref(reflect.TypeOf(entity))
+	for i := 0; i < meta.NumField(); i++ {
+		field := meta.Field(i)
+		collectMetainfo(field.Type, fieldName(field), Meta{}, result)
+	}
+	return result
+}
+
 func (meta Meta) Type(field string) Type {
 	if _, ok := meta[field]; ok {
 		return meta[field]
 	}
-	fieldParts := strings.Split(field, ".")
+	var fieldParts []string
+	for _, part := range SplitPath(field) {
+		if name, _, _, keyed := ParseSelector(part); keyed {
+			fieldParts = append(fieldParts, name, UpdateLastElement)
+		} else {
+			fieldParts = append(fieldParts, part)
+		}
+	}
 outer:
 	for metaField, kind := range meta {
 		metaFieldParts := strings.Split(metaField, ".")
@@ -93,8 +114,12 @@ outer:
 
 var typeOfDate = reflect.TypeOf(time.Time{})
 var typeOfDuration = reflect.TypeOf(time.Duration(0))
+var typeOfMoney = reflect.TypeOf(money.Amount(0))
 
-func collectMetainfo(meta reflect.Type, path string, result Meta) {
+func collectMetainfo(meta reflect.Type, path string, result Meta, nullable model.Set) {
+	if meta.Kind() == reflect.Ptr {
+		nullable[path] = struct{}{}
+	}
 	meta = deref(meta)
 	if meta == typeOfDate {
 		result[path] = Date
@@ -102,18 +127,21 @@ func collectMetainfo(meta reflect.Type, path string, result Meta) {
 	} else if meta == typeOfDuration {
 		result[path] = Duration
 		return
+	} else if meta == typeOfMoney {
+		result[path] = Money
+		return
 	}
 	switch meta.Kind() {
 	case reflect.Map:
-		collectMetainfo(meta.Elem(), path+".{}"+meta.Name(), result) // localizer.Ignore
+		collectMetainfo(meta.Elem(), path+".{}"+meta.Name(), result, nullable) // localizer.Ignore
 	case reflect.Slice:
-		collectMetainfo(meta.Elem(), path+".+", result) // localizer.Ignore
-		collectMetainfo(meta.Elem(), path+".-", result) // localizer.Ignore
+		collectMetainfo(meta.Elem(), path+".+", result, nullable) // localizer.Ignore
+		collectMetainfo(meta.Elem(), path+".-", result, nullable) // localizer.Ignore
 		result[path] = Slice
 	case reflect.Struct:
 		for i := 0; i < meta.NumField(); i++ {
 			field := meta.Field(i)
-			collectMetainfo(field.Type, path+"."+fieldName(field), result)
+			collectMetainfo(field.Type, path+"."+fieldName(field), result, nullable)
 		}
 	case reflect.Bool:
 		result[path] = Bool
@@ -128,6 +156,34 @@ func collectMetainfo(meta reflect.Type, path string, result Meta) {
 	}
 }
 
+func Tagged(entity interface{}, option string) model.Set {
+	result := model.Set{}
+	collectTagged(reflect.TypeOf(entity), "", option, result)
+	return result
+}
+
+func collectTagged(meta reflect.Type, path, option string, result model.Set) {
+	meta = deref(meta)
+	switch {
+	case meta.Kind() == reflect.Slice:
+		collectTagged(meta.Elem(), path+"."+AppendToSlice, option, result)
+	case meta.Kind() == reflect.Struct && meta != typeOfDate:
+		for i := 0; i < meta.NumField(); i++ {
+			field := meta.Field(i)
+			name := fieldName(field)
+			if path != "" {
+				name = path + "." + name
+			}
+			for _, tag := range strings.Split(field.Tag.Get("rules"), ",") {
+				if tag == option {
+					result[name] = struct{}{}
+				}
+			}
+			collectTagged(field.Type, name, option, result)
+		}
+	}
+}
+
 func fieldName(field reflect.StructField) string {
 	if name, ok := field.Tag.Lookup("json"); ok {
 		return name
@@ -143,55 +199,204 @@ func deref(meta reflect.Type) reflect.Type {
 }
 
 func Get(e model.Entity, field string) (result interface{}) {
-	entity := e
-	path := strings.Split(field, ".")
-	for _, field := range path[:len(path)-1] {
-		subEntity := entity[field]
-		if subEntity == nil {
+	var current interface{} = e
+	for _, part := range SplitPath(field) {
+		switch value := current.(type) {
+		case model.Entity:
+			current = getElement(value, part)
+		case map[string]interface{}:
+			current = getElement(model.Entity(value), part)
+		case []model.Entity:
+			current = nil
+			if part == UpdateLastElement {
+				if len(value) > 0 {
+					current = value[len(value)-1]
+				}
+			} else if index, err := strconv.Atoi(part); err == nil && index >= 0 && index < len(value) {
+				current = value[index]
+			}
+		default:
+			return nil
+		}
+		if current == nil {
 			return nil
 		}
-		if slice, ok := subEntity.([]model.Entity); ok {
-			return slice
+	}
+	return current
+}
+
+func getElement(entity model.Entity, part string) interface{} {
+	name, key, keyValue, keyed := ParseSelector(part)
+	if !keyed {
+		return entity[name]
+	}
+	slice, _ := entity[name].([]model.Entity)
+	for _, element := range slice {
+		if fmt.Sprint(element[key]) == keyValue {
+			return element
 		}
-		entity, _ = subEntity.(model.Entity)
 	}
-	return entity[path[len(path)-1]]
+	return nil
 }
 
-func Set(e model.Entity, field string, value interface{}) {
+func Set(e model.Entity, field string, value interface{}) error {
 	entity := e
-	path := strings.Split(field, ".")
+	path := SplitPath(field)
 	for i := 0; i < len(path)-1; i++ {
-		field := path[i]
+		name, key, keyValue, keyed := ParseSelector(path[i])
 		nextField := path[i+1]
+		if keyed {
+			element, err := keyedElement(entity, name, key, keyValue)
+			if err != nil {
+				return err
+			}
+			entity = element
+			continue
+		}
+		if i+1 == len(path)-1 && (nextField == AppendToSlice || nextField == UpdateLastElement) {
+			slice, _ := entity[name].([]interface{})
+			if nextField == AppendToSlice || len(slice) == 0 {
+				entity[name] = append(slice, value)
+			} else {
+				slice[len(slice)-1] = value
+			}
+			return nil
+		}
 		switch nextField {
 		case AppendToSlice:
+			slice, _ := entity[name].([]model.Entity)
 			newEntity := model.Entity{}
-			entity[field] = []model.Entity{newEntity}
+			entity[name] = append(slice, newEntity)
 			entity = newEntity
 			i++
 		case UpdateLastElement:
-			if slice, ok := entity[field].([]model.Entity); ok {
+			if slice, ok := entity[name].([]model.Entity); ok && len(slice) > 0 {
 				entity = slice[len(slice)-1]
 			} else {
 				newEntity := model.Entity{}
-				entity[field] = []model.Entity{newEntity}
+				entity[name] = append(slice, newEntity)
 				entity = newEntity
 			}
 			i++
 		default:
-			subEntity, ok := entity[field]
+			subEntity, ok := entity[name].(model.Entity)
 			if !ok {
 				subEntity = model.Entity{}
-				entity[field] = subEntity
+				entity[name] = subEntity
 			}
-			entity = subEntity.(model.Entity)
+			entity = subEntity
 		}
 	}
 	entity[path[len(path)-1]] = value
+	return nil
+}
+
+func keyedElement(entity model.Entity, name, key, keyValue string) (model.Entity, error) {
+	slice, ok := entity[name].([]model.Entity)
+	if !ok && entity[name] != nil {
+		return nil, fmt.Errorf("cannot select '%s[%s=%s]': '%s' is not a list of entities", name, key, keyValue, name) // localizer.Ignore
+	}
+	for _, element := range slice {
+		if fmt.Sprint(element[key]) == keyValue {
+			return element, nil
+		}
+	}
+	element := model.Entity{key: keyValue}
+	entity[name] = append(slice, element)
+	return element, nil
+}
+
+func SplitPath(field string) (result []string) {
+	start, depth := 0, 0
+	for i, ch := range field {
+		switch ch {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				result = append(result, field[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, field[start:])
+}
+
+func ParseSelector(part string) (name, key, value string, keyed bool) {
+	open := strings.IndexByte(part, '[')
+	if open < 0 || !strings.HasSuffix(part, "]") {
+		return part, "", "", false
+	}
+	selector := part[open+1 : len(part)-1]
+	equal := strings.IndexByte(selector, '=')
+	if equal < 0 {
+		return part, "", "", false
+	}
+	return part[:open], selector[:equal], selector[equal+1:], true
+}
+
+func (meta Meta) Restore(entity map[string]interface{}) model.Entity {
+	result := model.Entity{}
+	for key, value := range entity {
+		result[key] = meta.restore(key, value)
+	}
+	return result
+}
+
+func (meta Meta) restore(path string, value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if meta.Type(path) == Map {
+			return value
+		}
+		result := model.Entity{}
+		for key, element := range value {
+			result[key] = meta.restore(path+"."+key, element)
+		}
+		return result
+	case []interface{}:
+		entities := make([]model.Entity, 0, len(value))
+		for _, element := range value {
+			entity, ok := meta.restore(path+"."+AppendToSlice, element).(model.Entity)
+			if !ok {
+				break
+			}
+			entities = append(entities, entity)
+		}
+		if len(entities) == len(value) && len(value) > 0 {
+			return entities
+		}
+		result := make([]interface{}, len(value))
+		for i, element := range value {
+			result[i] = meta.restore(path+"."+AppendToSlice, element)
+		}
+		return result
+	case nil:
+		return nil
+	}
+	kind := meta.Type(path)
+	if kind == Invalid || kind == Map || kind == Slice {
+		return value
+	}
+	converted := ConvertValueToType(value, kind)
+	if _, ok := converted.(error); ok {
+		return value
+	}
+	return converted
 }
 
 func CommonType(params []interface{}) (result []interface{}) {
+	return Formats{}.CommonType(params)
+}
+
+func (f Formats) CommonType(params []interface{}) (result []interface{}) {
+	for _, param := range params {
+		if _, ok := param.(money.Amount); ok {
+			return f.convertSlice(params, Money)
+		}
+	}
 	commonType := reflect.TypeOf("")
 	commonKind := reflect.Invalid
 	for _, param := range params {
@@ -227,29 +432,70 @@ func CommonType(params []interface{}) (result []interface{}) {
 
 	switch commonType {
 	case typeOfDate:
-		return convertSliceToType(params, Date)
+		return f.convertSlice(params, Date)
 	case typeOfDuration:
-		return convertSliceToType(params, Duration)
+		return f.convertSlice(params, Duration)
 	}
 
 	switch commonKind {
 	case reflect.String:
-		return convertSliceToType(params, String)
+		return f.convertSlice(params, String)
 	case reflect.Bool:
-		return convertSliceToType(params, Bool)
+		return f.convertSlice(params, Bool)
 	case reflect.Int:
-		return convertSliceToType(params, Int)
+		return f.convertSlice(params, Int)
 	case reflect.Float64:
-		return convertSliceToType(params, Float)
+		return f.convertSlice(params, Float)
 	}
 
 	return params
 }
 
-func convertSliceToType(params []interface{}, kind Type) (result []interface{}) {
+func Compare(one, two interface{}) (int, error) {
+	return Formats{}.Compare(one, two)
+}
+
+func (f Formats) Compare(one, two interface{}) (int, error) {
+	params := f.CommonType([]interface{}{one, two})
+	if err, ok := params[0].(error); ok {
+		return 0, err
+	}
+	switch value := params[0].(type) {
+	case int:
+		return sign(float64(value - params[1].(int))), nil
+	case float64:
+		return sign(value - params[1].(float64)), nil
+	case string:
+		return strings.Compare(value, params[1].(string)), nil
+	case time.Time:
+		other := params[1].(time.Time)
+		if value.Before(other) {
+			return -1, nil
+		} else if value.After(other) {
+			return 1, nil
+		}
+		return 0, nil
+	case time.Duration:
+		return sign(float64(value - params[1].(time.Duration))), nil
+	case money.Amount:
+		return sign(float64(value - params[1].(money.Amount))), nil
+	}
+	return 0, fmt.Errorf("cannot compare values '%v' and '%v'", one, two) // localizer.Ignore
+}
+
+func sign(value float64) int {
+	if value < 0 {
+		return -1
+	} else if value > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (f Formats) convertSlice(params []interface{}, kind Type) (result []interface{}) {
 	result = make([]interface{}, len(params))
 	for i := range params {
-		result[i] = ConvertValueToType(params[i], kind)
+		result[i] = f.Convert(params[i], kind)
 		if _, ok := result[i].(error); ok {
 			return []interface{}{result[i]}
 		}
@@ -274,16 +520,39 @@ func ConvertValueToType(param interface{}, kind Type) interface{} {
 		return ConvertToDate(param)
 	case Duration:
 		return convertToDuration(param)
+	case Money:
+		return ConvertToMoney(param)
 	case Invalid:
 		return param
 	}
-	return fmt.Errorf("cannot convert value '%v' to %v", param, kind) // localizer.Ignore
+	return conversionError(fmt.Sprintf("cannot convert value '%%v' to %v", kind), param) // localizer.Ignore
+}
+
+type ConversionError struct {
+	Value  interface{}
+	format string
+}
+
+func conversionError(format string, value interface{}) *ConversionError {
+	return &ConversionError{Value: value, format: format}
+}
+
+func (e *ConversionError) Error() string {
+	return e.Message(e.Value)
+}
+
+func (e *ConversionError) Message(value interface{}) string {
+	return fmt.Sprintf(e.format, value)
+}
+
+func (e *ConversionError) WithPrefix(prefix string) *ConversionError {
+	return conversionError(strings.ReplaceAll(prefix, "%", "%%")+e.format, e.Value)
 }
 
 func ConvertToString(param interface{}) interface{} {
 	value := reflect.ValueOf(param)
 	if value.Kind() != reflect.String {
-		return fmt.Errorf("cannot convert value '%[1]v' of type %[1]T to string", param) // localizer.Ignore
+		return conversionError(fmt.Sprintf("cannot convert value '%%v' of type %T to string", param), param) // localizer.Ignore
 	}
 	return reflect.ValueOf(param).String()
 }
@@ -297,10 +566,10 @@ func convertToBool(param interface{}) interface{} {
 		} else if str == "false" {
 			return false
 		}
-		return fmt.Errorf("value '%v' is neither 'true' nor 'false'", param) // localizer.Ignore
+		return conversionError("value '%v' is neither 'true' nor 'false'", param) // localizer.Ignore
 	}
 	if value.Kind() != reflect.Bool {
-		return fmt.Errorf("cannot convert value '%v' to Boolean", param) // localizer.Ignore
+		return conversionError("cannot convert value '%v' to Boolean", param) // localizer.Ignore
 	}
 	return reflect.ValueOf(param).Bool()
 }
@@ -320,14 +589,49 @@ func convertToInt(param interface{}) interface{} {
 		}
 		i64, err := strconv.ParseInt(str, 10, 64)
 		if err != nil {
-			return fmt.Errorf("'%s' is not a number", str) // localizer.Ignore
+			return conversionError("'%v' is not a number", str) // localizer.Ignore
 		}
 		return int(i64)
 	}
-	return fmt.Errorf("cannot convert value '%v' to int", param) // localizer.Ignore
+	return conversionError("cannot convert value '%v' to int", param) // localizer.Ignore
+}
+
+func ConvertToMoney(param interface{}) interface{} {
+	return convertToMoney(param, 0)
+}
+
+func convertToMoney(param interface{}, decimal rune) interface{} {
+	switch value := param.(type) {
+	case money.Amount:
+		return value
+	case int:
+		return money.FromInt(value)
+	case float64:
+		return money.FromFloat(value)
+	case string:
+		if value == "" {
+			return nil
+		}
+		amount, err := money.ParseDecimal(value, decimal)
+		if parseErr, ok := err.(*money.ParseError); ok {
+			format := "cannot parse '%v' as an amount of money" // localizer.Ignore
+			if parseErr.Reason != "" {
+				format += ": " + strings.ReplaceAll(parseErr.Reason, "%", "%%")
+			}
+			return conversionError(format, value)
+		}
+		if err != nil {
+			return err
+		}
+		return amount
+	}
+	return conversionError("cannot convert value '%v' to money", param) // localizer.Ignore
 }
 
 func ConvertToFloat(param interface{}) interface{} {
+	if amount, ok := param.(money.Amount); ok {
+		return amount.Float()
+	}
 	paramKind := reflect.TypeOf(param).Kind()
 	if paramKind == reflect.Float64 {
 		return reflect.ValueOf(param).Float()
@@ -349,32 +653,69 @@ func ConvertToFloat(param interface{}) interface{} {
 		}
 
 	}
-	return fmt.Errorf("cannot convert value '%v' to float", param) // localizer.Ignore
+	return conversionError("cannot convert value '%v' to float", param) // localizer.Ignore
+}
+
+const ExcelDateFormat = "excel"
+
+var DefaultDateFormats = []string{"2006-01-02", "01/02/2006", "01-02-2006", time.RFC3339}
+
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+type Formats struct {
+	Dates   []string
+	Decimal rune
+}
+
+func (f Formats) Convert(param interface{}, kind Type) interface{} {
+	if param == nil {
+		return nil
+	}
+	switch kind {
+	case Date:
+		if len(f.Dates) > 0 {
+			return ConvertToDateWithFormats(param, f.Dates)
+		}
+	case Money:
+		return convertToMoney(param, f.Decimal)
+	}
+	return ConvertValueToType(param, kind)
 }
 
 func ConvertToDate(param interface{}) interface{} {
+	return ConvertToDateWithFormats(param, DefaultDateFormats)
+}
 
+func ConvertToDateWithFormats(param interface{}, formats []string) interface{} {
 	paramType := reflect.TypeOf(param)
 	if paramType == typeOfDate {
 		return param.(time.Time)
 	}
 	if paramType.Kind() == reflect.String {
-		str := reflect.ValueOf(param).String()
-		t, err := time.Parse("2006-01-02", str)
-		if err == nil {
-			return t
+		t, err := ParseDate(reflect.ValueOf(param).String(), formats)
+		if err != nil {
+			return err
 		}
-		t, err = time.Parse("01/02/2006", str)
-		if err == nil {
-			return t
+		return t
+	}
+	return conversionError("cannot convert '%s' to date", param) // localizer.Ignore
+}
+
+func ParseDate(str string, formats []string) (time.Time, error) {
+	for _, format := range formats {
+		if format == ExcelDateFormat {
+			serial, err := strconv.Atoi(str)
+			if err == nil && serial > 0 && serial < 2958466 {
+				return excelEpoch.AddDate(0, 0, serial), nil
+			}
+			continue
 		}
-		t, err = time.Parse("01-02-2006", str)
+		t, err := time.Parse(format, str)
 		if err == nil {
-			return t
+			return t, nil
 		}
-		return fmt.Errorf("cannot convert '%s' to date", param) // localizer.Ignore
 	}
-	return fmt.Errorf("cannot convert '%s' to date", param) // localizer.Ignore
+	return time.Time{}, conversionError("cannot convert '%v' to date", str) // localizer.Ignore
 }
 
 func convertToDuration(param interface{}) interface{} {
@@ -385,9 +726,9 @@ func convertToDuration(param interface{}) interface{} {
 	if reflect.TypeOf(param).Kind() == reflect.String {
 		d, err := time.ParseDuration(reflect.ValueOf(param).String())
 		if err != nil {
-			return fmt.Errorf("cannot convert '%s' to duration", param) // localizer.Ignore
+			return conversionError("cannot convert '%s' to duration", param) // localizer.Ignore
 		}
 		return d
 	}
-	return fmt.Errorf("cannot convert '%s' to duration", param) // localizer.Ignore
+	return conversionError("cannot convert '%s' to duration", param) // localizer.Ignore
 }
@@ -0,0 +1,487 @@
+package meta
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"league.com/rulemaker/canonical_model"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/util"
+)
+
+func TestSet(t *testing.T) {
+	for i, test := range setFixture {
+		entity := model.Entity{}
+		for _, assignment := range test.assignments {
+			if err := Set(entity, assignment.field, assignment.value); err != nil {
+				t.Fatal(i, err)
+			}
+		}
+		if !reflect.DeepEqual(entity, test.expected) {
+			log.Println("fixture  ", i)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", entity)
+			t.FailNow()
+		}
+	}
+
+	entity := model.Entity{"d": "scalar"}
+	if err := Set(entity, "d[id=1].x", "a"); err == nil || entity["d"] != "scalar" {
+		log.Println("keyed selector overwrote a non-entity value:", entity, err)
+		t.FailNow()
+	}
+}
+
+type assignment struct {
+	field string
+	value interface{}
+}
+
+var setFixture = []struct {
+	assignments []assignment
+	expected    model.Entity
+}{
+	{[]assignment{{"a", 1}}, model.Entity{"a": 1}},
+	{[]assignment{{"a.b", 1}}, model.Entity{"a": model.Entity{"b": 1}}},
+	{
+		[]assignment{{"d.+.x", 1}, {"d.-.y", 2}, {"d.+.x", 3}},
+		model.Entity{"d": []model.Entity{{"x": 1, "y": 2}, {"x": 3}}},
+	},
+	{
+		[]assignment{{"d.-.x", 1}},
+		model.Entity{"d": []model.Entity{{"x": 1}}},
+	},
+	{
+		[]assignment{{"d[id=1].x", "a"}, {"d[id=2].x", "b"}, {"d[id=1].y", "c"}},
+		model.Entity{"d": []model.Entity{{"id": "1", "x": "a", "y": "c"}, {"id": "2", "x": "b"}}},
+	},
+	{
+		[]assignment{{"s.+", "a"}, {"s.+", "b"}, {"s.-", "c"}},
+		model.Entity{"s": []interface{}{"a", "c"}},
+	},
+}
+
+func TestGet(t *testing.T) {
+	entity := model.Entity{
+		"a": model.Entity{"b": 1},
+		"d": []model.Entity{{"id": "1", "x": "a"}, {"id": "2", "x": "b"}},
+	}
+	for i, test := range getFixture {
+		got := Get(entity, test.field)
+		if !reflect.DeepEqual(got, test.expected) {
+			log.Println("fixture  ", i)
+			log.Println("field    ", test.field)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", got)
+			t.FailNow()
+		}
+	}
+}
+
+var getFixture = []struct {
+	field    string
+	expected interface{}
+}{
+	{"a.b", 1},
+	{"a.c", nil},
+	{"x.y", nil},
+	{"d.0.x", "a"},
+	{"d.1.x", "b"},
+	{"d.2.x", nil},
+	{"d.-.x", "b"},
+	{"d.+.x", nil},
+	{"d[id=2].x", "b"},
+	{"d[id=3].x", nil},
+	{"d[id=1]", model.Entity{"id": "1", "x": "a"}},
+}
+
+func TestType(t *testing.T) {
+	metainfo := Metainfo(canonical_model.EmployeeDTO{})
+	for i, test := range typeFixture {
+		got := metainfo.Type(test.field)
+		if got != test.expected {
+			log.Println("fixture  ", i)
+			log.Println("field    ", test.field)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", got)
+			t.FailNow()
+		}
+	}
+}
+
+var typeFixture = []struct {
+	field    string
+	expected Type
+}{
+	{"first_name", String},
+	{"dependents", Slice},
+	{"dependents.+.first_name", String},
+	{"dependents.-.date_of_birth", Date},
+	{"dependents[dependent_id=123].sex", String},
+	{"dependents[dependent_id=$dependent_id].student", Bool},
+	{"dependents[dependent_id].sex", Invalid},
+	{"unknown", Invalid},
+}
+
+func TestTagged(t *testing.T) {
+	got := Tagged(canonical_model.EmployeeDTO{}, "required")
+	expected := model.Set{
+		"employee_id":            {},
+		"first_name":             {},
+		"last_name":              {},
+		"date_of_birth":          {},
+		"benefit_class":          {},
+		"date_of_hire":           {},
+		"province_of_employment": {},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		log.Println("expected ", expected)
+		log.Println("got      ", got)
+		t.FailNow()
+	}
+}
+
+func TestSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "custom.json")
+	schema := `{"union_local": "string", "seniority_date": "date", "union": {"dues": "money", "member": "bool"}}`
+	if err := ioutil.WriteFile(path, []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := ReadSchema(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metainfo := Metainfo(canonical_model.EmployeeDTO{}).WithSchema("custom_fields", custom)
+	for i, test := range schemaFixture {
+		got := metainfo.Type(test.field)
+		if got != test.expected {
+			log.Println("fixture  ", i)
+			log.Println("field    ", test.field)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", got)
+			t.FailNow()
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"union_local": "text"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSchema(path); err == nil {
+		log.Println("expected an error for an unknown type")
+		t.FailNow()
+	}
+}
+
+var schemaFixture = []struct {
+	field    string
+	expected Type
+}{
+	{"custom_fields.union_local", String},
+	{"custom_fields.seniority_date", Date},
+	{"custom_fields.union.dues", Money},
+	{"custom_fields.union.member", Bool},
+	{"custom_fields.unknown", Invalid},
+	{"first_name", String},
+}
+
+func TestJSONSchema(t *testing.T) {
+	for _, entity := range []interface{}{canonical_model.EmployeeDTO{}, canonical_model.BenefitElectionDTO{}} {
+		original := NewModel("test", entity, "employee_id")
+		original.Validators = nil
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(util.ToJson(original.JSONSchema())), &schema); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseJSONSchema(schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, original) {
+			log.Println("expected ", original)
+			log.Println("got      ", got)
+			t.FailNow()
+		}
+	}
+
+	for i, test := range jsonSchemaFixture {
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(test.schema), &schema); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseJSONSchema(schema)
+		if test.expected == nil {
+			if err == nil {
+				log.Println("fixture  ", i)
+				log.Println("expected an error")
+				t.FailNow()
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got.Metainfo, test.expected) {
+			log.Println("fixture  ", i)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", got.Metainfo, err)
+			t.FailNow()
+		}
+	}
+}
+
+var jsonSchemaFixture = []struct {
+	schema   string
+	expected Meta
+}{
+	{`{"x-id-field": "id", "properties": {"id": {"type": "string"}, "paid": {"type": "number", "x-type": "money"}, "born": {"type": ["string", "null"], "format": "date"}}}`,
+		Meta{"id": String, "paid": Money, "born": Date}},
+	{`{"x-id-field": "id", "properties": {"id": {"type": "integer"}, "tags": {"type": "array", "items": {"type": "string"}}, "extra": {"type": "object"}}}`,
+		Meta{"id": Int, "tags": Slice, "tags.+": String, "tags.-": String, "extra.{}": Map}},
+	{`{"x-id-field": "id", "properties": {"id": {"type": "string"}, "limits": {"type": "object", "additionalProperties": {"type": "integer"}}}}`,
+		Meta{"id": String, "limits.{}": Int}},
+	{`{"properties": {"id": {"type": "string"}}}`, nil},
+	{`{"x-id-field": "key", "properties": {"id": {"type": "string"}}}`, nil},
+	{`{"x-id-field": "id", "properties": {"id": {"type": ["string", "integer"]}}}`, nil},
+	{`{"x-id-field": "id", "properties": {"id": {"type": "string", "x-type": "text"}}}`, nil},
+}
+
+func TestValidators(t *testing.T) {
+	metainfo := Metainfo(canonical_model.EmployeeDTO{})
+	validators := TaggedValidators(canonical_model.EmployeeDTO{}).Merge(Validators{
+		{Field: "national_identification_number", Kind: LuhnValidator, Action: model.Fail},
+		{Field: "sex", Kind: EnumValidator, Values: []string{"M", "F", "X"}},
+		{Field: "hrs_worked_per_week", Kind: RangeValidator, Min: "0", Max: "80", Action: model.Ticket},
+		{Field: "email", Kind: RegexValidator, Pattern: `^[^@]+@[^@]+$`},
+		{Field: "dependents.+.date_of_birth", Kind: RangeValidator, Min: "1900-01-01", Max: "today"},
+	})
+	if err := validators.Prepare(metainfo); err != nil {
+		t.Fatal(err)
+	}
+	today := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, test := range validatorFixture {
+		entry := &model.Entry{Entity: test.entity}
+		validators.Validate(metainfo, entry, today)
+		if !reflect.DeepEqual(entry.Diagnostics, test.expected) {
+			log.Println("fixture  ", i)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", entry.Diagnostics)
+			t.FailNow()
+		}
+	}
+
+	if err := (Validators{{Field: "nickname", Kind: LuhnValidator}}).Prepare(metainfo); err == nil {
+		log.Println("expected an error for an unknown field")
+		t.FailNow()
+	}
+	if err := (Validators{{Field: "city", Kind: RangeValidator, Min: "A"}}).Prepare(metainfo); err == nil {
+		log.Println("expected an error for a range of strings")
+		t.FailNow()
+	}
+}
+
+var validatorFixture = []struct {
+	entity   model.Entity
+	expected model.Diagnostics
+}{
+	{model.Entity{
+		"national_identification_number": "046 454 286",
+		"postal_code":                    "k1a 0b1",
+		"province":                       "on",
+		"date_of_birth":                  time.Date(1980, 1, 2, 0, 0, 0, 0, time.UTC),
+		"email":                          "ann@example.com",
+		"hrs_worked_per_week":            37.5,
+	}, nil},
+	{model.Entity{"national_identification_number": "046 454 287", "province_of_employment": "PQ"}, model.Diagnostics{
+		{Message: "national_identification_number: '046 454 287' fails the Luhn checksum", Field: "national_identification_number", Action: model.Fail},
+		{Message: "province_of_employment: 'PQ' is not a Canadian province or territory code", Field: "province_of_employment", Action: model.Log},
+	}},
+	{model.Entity{"postal_code": "D1A 0B1", "date_of_birth": time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), "sex": "U"}, model.Diagnostics{
+		{Message: "date_of_birth: 2021-01-01 is after 2020-06-01", Field: "date_of_birth", Action: model.Log},
+		{Message: "postal_code: 'D1A 0B1' is not a valid Canadian postal code", Field: "postal_code", Action: model.Log},
+		{Message: "sex: 'U' is not one of M, F, X", Field: "sex", Action: model.Log},
+	}},
+	{model.Entity{"hrs_worked_per_week": 90.0, "email": "ann"}, model.Diagnostics{
+		{Message: "hrs_worked_per_week: 90 is greater than 80", Field: "hrs_worked_per_week", Action: model.Ticket},
+		{Message: "email: 'ann' does not match '^[^@]+@[^@]+$'", Field: "email", Action: model.Log},
+	}},
+	{model.Entity{"dependents": []model.Entity{
+		{"date_of_birth": time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"date_of_birth": time.Date(1850, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}}, model.Diagnostics{
+		{Message: "dependents.1.date_of_birth: 1850-01-01 is before 1900-01-01", Field: "dependents.1.date_of_birth", Action: model.Log},
+	}},
+}
+
+func TestConstraints(t *testing.T) {
+	metainfo := Metainfo(canonical_model.EmployeeDTO{})
+	constraints := append(RequiredConstraints(model.Set{"employee_id": {}}), canonical_model.Models[canonical_model.DefaultModel].Constraints...)
+	constraints = append(constraints, model.Constraint{Name: "dependent_relationship_after_birth", Field: "dependents.+.relationship_effective_date", Operator: ">=", Other: "dependents.+.date_of_birth", Action: model.Ticket})
+	if err := PrepareConstraints(constraints, metainfo); err != nil {
+		t.Fatal(err)
+	}
+	entries := model.Entries{}
+	for i, test := range constraintFixture {
+		entry := &model.Entry{Entity: test.entity}
+		CheckConstraints(constraints, entry)
+		var got []string
+		for _, d := range entry.Diagnostics {
+			got = append(got, d.Message)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			log.Println("fixture  ", i)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", got)
+			t.FailNow()
+		}
+		entries[strconv.Itoa(i)] = entry
+	}
+	expected := map[string]int{
+		"required_employee_id":               1,
+		"hired_before_termination":           1,
+		"benefits_start_after_hire":          1,
+		"dependent_younger_than_employee":    2,
+		"dependent_relationship_after_birth": 1,
+	}
+	if got := entries.Violations(); !reflect.DeepEqual(got, expected) {
+		log.Println("expected ", expected)
+		log.Println("got      ", got)
+		t.FailNow()
+	}
+
+	for _, invalid := range []model.Constraints{
+		{{Name: "a", Field: "date_of_hire", Operator: "<=", Other: "hire_date"}},
+		{{Name: "a", Field: "date_of_hire", Operator: "before", Other: "termination_date"}},
+		{{Name: "a", Field: "date_of_hire", Operator: RequiredOperator}, {Name: "a", Field: "first_name", Operator: RequiredOperator}},
+	} {
+		if err := PrepareConstraints(invalid, metainfo); err == nil {
+			log.Println("expected an error for", invalid)
+			t.FailNow()
+		}
+	}
+}
+
+func date(year, month, day int) time.Time {
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+var constraintFixture = []struct {
+	entity   model.Entity
+	expected []string
+}{
+	{model.Entity{"employee_id": "1", "date_of_hire": date(2010, 1, 1), "termination_date": date(2020, 1, 1), "benefits_start_date": date(2010, 1, 1)}, nil},
+	{model.Entity{"employee_id": "2", "date_of_hire": date(2021, 1, 1), "termination_date": date(2020, 1, 1), "benefits_start_date": date(2020, 12, 1)}, []string{
+		"hired_before_termination: date_of_hire 2021-01-01 must be on or before termination_date 2020-01-01",
+		"benefits_start_after_hire: benefits_start_date 2020-12-01 must be on or after date_of_hire 2021-01-01",
+	}},
+	{model.Entity{"date_of_birth": date(1980, 1, 1), "dependents": []model.Entity{
+		{"date_of_birth": date(2005, 1, 1), "relationship_effective_date": date(2005, 1, 1)},
+		{"date_of_birth": date(1975, 1, 1)},
+		{"date_of_birth": date(1980, 1, 1), "relationship_effective_date": date(1979, 1, 1)},
+	}}, []string{
+		"required_employee_id: 'employee_id' is required",
+		"dependent_younger_than_employee: dependents.1.date_of_birth 1975-01-01 must be after date_of_birth 1980-01-01",
+		"dependent_younger_than_employee: dependents.2.date_of_birth 1980-01-01 must be after date_of_birth 1980-01-01",
+		"dependent_relationship_after_birth: dependents.2.relationship_effective_date 1979-01-01 must be on or after dependents.2.date_of_birth 1980-01-01",
+	}},
+}
+
+func TestMask(t *testing.T) {
+	sensitive := Tagged(canonical_model.EmployeeDTO{}, "sensitive")
+	expected := model.Set{"date_of_birth": {}, "national_identification_number": {}, "dependents.+.date_of_birth": {}}
+	if !reflect.DeepEqual(sensitive, expected) {
+		log.Println("expected ", expected)
+		log.Println("got      ", sensitive)
+		t.FailNow()
+	}
+
+	entity := model.Entity{
+		"first_name":                     "Ann",
+		"national_identification_number": "046454286",
+		"date_of_birth":                  date(1980, 1, 2),
+		"dependents":                     []model.Entity{{"first_name": "Bob", "date_of_birth": date(2005, 3, 4)}},
+	}
+	masked := NewMasker(sensitive, Masked).Entity(entity)
+	expectedEntity := model.Entity{
+		"first_name":                     "Ann",
+		"national_identification_number": "******286",
+		"date_of_birth":                  "**********",
+		"dependents":                     []model.Entity{{"first_name": "Bob", "date_of_birth": "**********"}},
+	}
+	if !reflect.DeepEqual(masked, expectedEntity) {
+		log.Println("expected ", expectedEntity)
+		log.Println("got      ", masked)
+		t.FailNow()
+	}
+	if entity["national_identification_number"] != "046454286" {
+		log.Println("masking changed the entity")
+		t.FailNow()
+	}
+
+	for i, test := range maskFixture {
+		masker := NewMasker(sensitive, test.mode)
+		if got := masker.Value(test.field, test.value); got != test.expected {
+			log.Println("fixture  ", i)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", got)
+			t.FailNow()
+		}
+	}
+
+	entry := &model.Entry{Entity: model.Entity{"date_of_birth": date(1850, 2, 3), "national_identification_number": "abc", "dependents": []model.Entity{{"date_of_birth": date(1840, 1, 1)}}}}
+	entry.SetMasker(NewMasker(sensitive, Masked))
+	err := ConvertToDate("1980-31-31").(*ConversionError).WithPrefix("input 'birth_date': ")
+	entry.Report(err.Message(entry.Mask("date_of_birth", err.Value)), "date_of_birth", model.Fail)
+	validators := TaggedValidators(canonical_model.EmployeeDTO{})
+	if err := validators.Prepare(Metainfo(canonical_model.EmployeeDTO{})); err != nil {
+		t.Fatal(err)
+	}
+	validators.Validate(Metainfo(canonical_model.EmployeeDTO{}), entry, date(2020, 1, 1))
+	constraint := model.Constraint{Name: "dependent_younger_than_employee", Field: "dependents.+.date_of_birth", Operator: ">", Other: "date_of_birth"}
+	if err := PrepareConstraints(model.Constraints{constraint}, Metainfo(canonical_model.EmployeeDTO{})); err != nil {
+		t.Fatal(err)
+	}
+	CheckConstraints(model.Constraints{constraint}, entry)
+	messages := []string{}
+	for _, d := range entry.Diagnostics {
+		messages = append(messages, d.Message)
+	}
+	expectedMessages := []string{
+		"input 'birth_date': cannot convert '*******-31' to date",
+		"date_of_birth: ********** is before 1900-01-01",
+		"national_identification_number: '***' fails the Luhn checksum",
+		"dependent_younger_than_employee: dependents.0.date_of_birth ********** must be after date_of_birth **********",
+	}
+	if !reflect.DeepEqual(messages, expectedMessages) {
+		log.Println("expected ", expectedMessages)
+		log.Println("got      ", messages)
+		t.FailNow()
+	}
+	if text := entry.String(); strings.Contains(text, "1850") || strings.Contains(text, "abc") {
+		log.Println("expected a masked entry, got", text)
+		t.FailNow()
+	}
+}
+
+var maskFixture = []struct {
+	field    string
+	value    interface{}
+	mode     MaskMode
+	expected interface{}
+}{
+	{"national_identification_number", "046454286", Hashed, "sha256:1a4e63fbc854"},
+	{"national_identification_number", "046454286", Unmasked, "046454286"},
+	{"dependents.0.date_of_birth", date(2005, 3, 4), Masked, "**********"},
+	{"dependents[dependent_id=A].date_of_birth", "2005-03-04", Masked, "**********"},
+	{"dependents.-.first_name", "Bob", Masked, "Bob"},
+	{"first_name", "Ann", Masked, "Ann"},
+}
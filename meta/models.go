@@ -0,0 +1,48 @@
+package meta
+
+import (
+	"sort"
+
+	"league.com/rulemaker/model"
+)
+
+type Model struct {
+	Name        string
+	Metainfo    Meta
+	Required    model.Set
+	Nullable    model.Set
+	Sensitive   model.Set
+	IdField     string
+	Validators  Validators
+	Constraints model.Constraints
+}
+
+type Models map[string]Model
+
+func NewModel(name string, entity interface{}, idField string) Model {
+	result := Model{
+		Name:       name,
+		Metainfo:   Metainfo(entity),
+		Required:   Tagged(entity, "required"),
+		Nullable:   Nullable(entity),
+		Sensitive:  Tagged(entity, "sensitive"),
+		IdField:    idField,
+		Validators: TaggedValidators(entity),
+	}
+	result.Constraints = RequiredConstraints(result.Required)
+	return result
+}
+
+func (m Model) WithSchema(root string, schema Meta) Model {
+	m.Metainfo = m.Metainfo.WithSchema(root, schema)
+	return m
+}
+
+func (models Models) Names() []string {
+	result := make([]string, 0, len(models))
+	for name := range models {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,301 @@
+package meta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/money"
+)
+
+const (
+	RegexValidator      = "regex"       // localizer.Ignore
+	EnumValidator       = "enum"        // localizer.Ignore
+	RangeValidator      = "range"       // localizer.Ignore
+	LuhnValidator       = "luhn"        // localizer.Ignore
+	PostalCodeValidator = "postal_code" // localizer.Ignore
+	ProvinceValidator   = "province"    // localizer.Ignore
+)
+
+const todayBound = "today" // localizer.Ignore
+
+type Validator struct {
+	Model   string       `json:"model,omitempty"`
+	Field   string       `json:"field"`
+	Kind    string       `json:"kind"`
+	Pattern string       `json:"pattern,omitempty"`
+	Values  []string     `json:"values,omitempty"`
+	Min     string       `json:"min,omitempty"`
+	Max     string       `json:"max,omitempty"`
+	Action  model.Action `json:"action,omitempty"`
+
+	regexp *regexp.Regexp
+}
+
+type Validators []*Validator
+
+var postalCode = regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[ABCEGHJ-NPRSTV-Z] ?\d[ABCEGHJ-NPRSTV-Z]\d$`)
+
+var provinceCodes = []string{"AB", "BC", "MB", "NB", "NL", "NS", "NT", "NU", "ON", "PE", "QC", "SK", "YT"}
+
+func TaggedValidators(entity interface{}) (result Validators) {
+	meta := deref(reflect.TypeOf(entity))
+	for i := 0; i < meta.NumField(); i++ {
+		field := meta.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		for _, option := range strings.Split(tag, ",") {
+			validator := &Validator{Field: fieldName(field), Kind: option}
+			if index := strings.Index(option, "="); index >= 0 {
+				validator.Kind = option[:index]
+				argument := option[index+1:]
+				switch validator.Kind {
+				case EnumValidator:
+					validator.Values = strings.Split(argument, "|")
+				case RangeValidator:
+					bounds := strings.SplitN(argument, "..", 2)
+					validator.Min = bounds[0]
+					if len(bounds) > 1 {
+						validator.Max = bounds[1]
+					}
+				default:
+					validator.Pattern = argument
+				}
+			}
+			result = append(result, validator)
+		}
+	}
+	return result
+}
+
+func ReadValidators(path string) (Validators, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var result Validators
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err) // localizer.Ignore
+	}
+	return result, nil
+}
+
+func (v Validators) ForModel(name string, metainfo Meta) (result Validators) {
+	for _, validator := range v {
+		if validator.Model == name || validator.Model == "" && metainfo.Type(validator.Field) != Invalid {
+			result = append(result, validator)
+		}
+	}
+	return result
+}
+
+func (v Validators) Merge(overrides Validators) Validators {
+	result := append(Validators{}, v...)
+outer:
+	for _, override := range overrides {
+		for i, validator := range result {
+			if validator.Field == override.Field && validator.Kind == override.Kind {
+				merged := *validator
+				if override.Pattern != "" {
+					merged.Pattern = override.Pattern
+				}
+				if len(override.Values) > 0 {
+					merged.Values = override.Values
+				}
+				if override.Min != "" || override.Max != "" {
+					merged.Min, merged.Max = override.Min, override.Max
+				}
+				if override.Action != "" {
+					merged.Action = override.Action
+				}
+				result[i] = &merged
+				continue outer
+			}
+		}
+		result = append(result, override)
+	}
+	return result
+}
+
+func (v Validators) Prepare(metainfo Meta) error {
+	for _, validator := range v {
+		kind := metainfo.Type(validator.Field)
+		if kind == Invalid {
+			return fmt.Errorf("validator '%s': canonical model does not have field '%s'", validator.Kind, validator.Field) // localizer.Ignore
+		}
+		if validator.Action == "" {
+			validator.Action = model.Log
+		}
+		switch validator.Kind {
+		case RegexValidator:
+			re, err := regexp.Compile(validator.Pattern)
+			if err != nil {
+				return fmt.Errorf("validator '%s' of '%s': %v", validator.Kind, validator.Field, err) // localizer.Ignore
+			}
+			validator.regexp = re
+		case EnumValidator:
+			if len(validator.Values) == 0 {
+				return fmt.Errorf("validator '%s' of '%s': no values", validator.Kind, validator.Field) // localizer.Ignore
+			}
+		case RangeValidator:
+			for _, bound := range []string{validator.Min, validator.Max} {
+				if _, err := parseBound(bound, kind, time.Time{}); err != nil {
+					return fmt.Errorf("validator '%s' of '%s': %v", validator.Kind, validator.Field, err) // localizer.Ignore
+				}
+			}
+		case LuhnValidator, PostalCodeValidator, ProvinceValidator:
+		default:
+			return fmt.Errorf("unknown validator '%s' of '%s'", validator.Kind, validator.Field) // localizer.Ignore
+		}
+	}
+	return nil
+}
+
+func (v Validators) Validate(metainfo Meta, entry *model.Entry, today time.Time) {
+	if today.IsZero() {
+		today = time.Now()
+	}
+	for _, validator := range v {
+		for _, field := range expandPath(entry.Entity, validator.Field) {
+			value := Get(entry.Entity, field)
+			if value == nil || value == "" {
+				continue
+			}
+			shown := formatValue(entry.Mask(field, value))
+			if message := validator.check(metainfo.Type(validator.Field), value, shown, today); message != "" {
+				entry.Report(fmt.Sprintf("%s: %s", field, message), field, validator.Action) // localizer.Ignore
+			}
+		}
+	}
+}
+
+func (validator *Validator) check(kind Type, value interface{}, shown string, today time.Time) string {
+	text := fmt.Sprint(value)
+	switch validator.Kind {
+	case RegexValidator:
+		if validator.regexp == nil || !validator.regexp.MatchString(text) {
+			return fmt.Sprintf("'%s' does not match '%s'", shown, validator.Pattern) // localizer.Ignore
+		}
+	case EnumValidator:
+		for _, allowed := range validator.Values {
+			if text == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("'%s' is not one of %s", shown, strings.Join(validator.Values, ", ")) // localizer.Ignore
+	case RangeValidator:
+		return validator.checkRange(kind, value, shown, today)
+	case LuhnValidator:
+		if !Luhn(text) {
+			return fmt.Sprintf("'%s' fails the Luhn checksum", shown) // localizer.Ignore
+		}
+	case PostalCodeValidator:
+		if !postalCode.MatchString(strings.ToUpper(strings.TrimSpace(text))) {
+			return fmt.Sprintf("'%s' is not a valid Canadian postal code", shown) // localizer.Ignore
+		}
+	case ProvinceValidator:
+		for _, code := range provinceCodes {
+			if strings.EqualFold(text, code) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("'%s' is not a Canadian province or territory code", shown) // localizer.Ignore
+	}
+	return ""
+}
+
+func (validator *Validator) checkRange(kind Type, value interface{}, shown string, today time.Time) string {
+	min, _ := parseBound(validator.Min, kind, today)
+	max, _ := parseBound(validator.Max, kind, today)
+	if kind == Date {
+		date, ok := ConvertToDate(value).(time.Time)
+		if !ok {
+			return fmt.Sprintf("'%s' is not a date", shown) // localizer.Ignore
+		}
+		if min, ok := min.(time.Time); ok && date.Before(min) {
+			return fmt.Sprintf("%s is before %s", shown, min.Format("2006-01-02")) // localizer.Ignore
+		}
+		if max, ok := max.(time.Time); ok && date.After(max) {
+			return fmt.Sprintf("%s is after %s", shown, max.Format("2006-01-02")) // localizer.Ignore
+		}
+		return ""
+	}
+	number, ok := ConvertToFloat(value).(float64)
+	if !ok {
+		return fmt.Sprintf("'%s' is not a number", shown) // localizer.Ignore
+	}
+	if min, ok := min.(float64); ok && number < min {
+		return fmt.Sprintf("%s is less than %v", shown, validator.Min) // localizer.Ignore
+	}
+	if max, ok := max.(float64); ok && number > max {
+		return fmt.Sprintf("%s is greater than %v", shown, validator.Max) // localizer.Ignore
+	}
+	return ""
+}
+
+func parseBound(bound string, kind Type, today time.Time) (interface{}, error) {
+	if bound == "" {
+		return nil, nil
+	}
+	switch kind {
+	case Date:
+		if bound == todayBound {
+			return today, nil
+		}
+		return ParseDate(bound, DefaultDateFormats)
+	case Money:
+		amount, err := money.Parse(bound)
+		return amount.Float(), err
+	case Int, Float:
+		return strconv.ParseFloat(bound, 64)
+	}
+	return nil, fmt.Errorf("a range does not apply to %v fields", kind) // localizer.Ignore
+}
+
+func Luhn(number string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(number)
+	if len(digits) < 2 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		digit := digits[len(digits)-1-i]
+		if digit < '0' || digit > '9' {
+			return false
+		}
+		value := int(digit - '0')
+		if i%2 == 1 {
+			value *= 2
+			if value > 9 {
+				value -= 9
+			}
+		}
+		sum += value
+	}
+	return sum%10 == 0
+}
+
+func expandPath(entity model.Entity, field string) []string {
+	parts := SplitPath(field)
+	for i, part := range parts {
+		if part != AppendToSlice {
+			continue
+		}
+		elements, _ := Get(entity, strings.Join(parts[:i], ".")).([]model.Entity)
+		var result []string
+		for index := range elements {
+			expanded := append(append(append([]string{}, parts[:i]...), strconv.Itoa(index)), parts[i+1:]...)
+			result = append(result, expandPath(entity, strings.Join(expanded, "."))...)
+		}
+		return result
+	}
+	return []string{field}
+}
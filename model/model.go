@@ -72,8 +72,10 @@ type Records []Record
 
 type Entity msg.M
 
-func (e Entity) EntityId() string {
-	id, _ := e["employee_id"].(string)
+const DefaultIdField = "employee_id"
+
+func (e Entity) Id(field string) string {
+	id, _ := e[field].(string)
 	return id
 }
 
@@ -89,13 +91,25 @@ var (
 )
 
 type Diagnostic struct {
-	Message string
-	Field   string
-	Action  Action
+	Message    string
+	Field      string
+	Action     Action
+	Constraint string
 }
 
 type Diagnostics []Diagnostic
 
+type Constraint struct {
+	Name     string `json:"name"`
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Other    string `json:"other,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Action   Action `json:"action,omitempty"`
+}
+
+type Constraints []Constraint
+
 type Source struct {
 	FilePath   string `bson:"file_path"`
 	LineNumber int    `bson:"line_number"`
@@ -103,17 +117,63 @@ type Source struct {
 
 type Sources []Source
 
+type Masker interface {
+	Sensitive(field string) bool
+	Value(field string, value interface{}) interface{}
+	Entity(entity Entity) Entity
+}
+
 type Entries map[string]*Entry
 type Entry struct {
 	Entity      Entity
 	Sources     Sources
 	Diagnostics Diagnostics
+	masker      Masker
 }
 
 func (e *Entry) String() string {
-	return util.ToJson(e)
+	if e.masker == nil {
+		return util.ToJson(e)
+	}
+	return util.ToJson(&Entry{Entity: e.masker.Entity(e.Entity), Sources: e.Sources, Diagnostics: e.Diagnostics})
+}
+
+func (e *Entry) SetMasker(masker Masker) {
+	e.masker = masker
+}
+
+func (e *Entry) Mask(field string, value interface{}) interface{} {
+	if e.masker == nil {
+		return value
+	}
+	return e.masker.Value(field, value)
 }
 
 func (e *Entry) Report(message string, field string, action Action) {
 	e.Diagnostics = append(e.Diagnostics, Diagnostic{Message: message, Field: field, Action: action})
 }
+
+func (e *Entry) Violate(constraint Constraint, message string, field string) {
+	e.Diagnostics = append(e.Diagnostics, Diagnostic{Message: message, Field: field, Action: constraint.Action, Constraint: constraint.Name})
+}
+
+func (e *Entry) Has(action Action) bool {
+	for _, d := range e.Diagnostics {
+		if d.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Entries) Violations() map[string]int {
+	result := map[string]int{}
+	for _, entry := range e {
+		for _, d := range entry.Diagnostics {
+			if d.Constraint != "" {
+				result[d.Constraint]++
+			}
+		}
+	}
+	return result
+}
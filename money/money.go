@@ -0,0 +1,193 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type Amount int64
+
+func FromCents(cents int64) Amount {
+	return Amount(cents)
+}
+
+func FromInt(value int) Amount {
+	return Amount(int64(value) * 100)
+}
+
+func FromFloat(value float64) Amount {
+	return Amount(round(new(big.Rat).Mul(new(big.Rat).SetFloat64(value), big.NewRat(100, 1))))
+}
+
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+func (a Amount) Float() float64 {
+	return float64(a) / 100
+}
+
+func (a Amount) Mul(factor *big.Rat) Amount {
+	return Amount(round(new(big.Rat).Mul(big.NewRat(int64(a), 1), factor)))
+}
+
+func round(value *big.Rat) int64 {
+	numerator := new(big.Int).Set(value.Num())
+	denominator := value.Denom()
+	negative := numerator.Sign() < 0
+	numerator.Abs(numerator)
+	quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	if remainder.Mul(remainder, big.NewInt(2)).Cmp(denominator) >= 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if negative {
+		quotient.Neg(quotient)
+	}
+	return quotient.Int64()
+}
+
+func (a Amount) String() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	amount, err := Parse(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}\s*|\s*[A-Z]{3}$`)
+
+func Parse(text string) (Amount, error) {
+	return ParseDecimal(text, 0)
+}
+
+type ParseError struct {
+	Text, Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("cannot parse '%s' as an amount of money", e.Text)
+	}
+	return fmt.Sprintf("cannot parse '%s' as an amount of money: %s", e.Text, e.Reason)
+}
+
+func ParseDecimal(text string, decimal rune) (Amount, error) {
+	value := strings.TrimSpace(text)
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	}
+	value = currencyCode.ReplaceAllString(value, "")
+	value = strings.TrimFunc(value, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.Is(unicode.Sc, r)
+	})
+	if strings.HasSuffix(value, "-") {
+		negative = !negative
+		value = strings.TrimSpace(value[:len(value)-1])
+	} else if strings.HasPrefix(value, "-") {
+		negative = !negative
+		value = strings.TrimSpace(value[1:])
+	}
+	value = strings.TrimFunc(value, func(r rune) bool {
+		return unicode.Is(unicode.Sc, r) || unicode.IsSpace(r)
+	})
+
+	units, fraction, err := split(value, decimal)
+	if err != nil {
+		return 0, &ParseError{Text: text, Reason: err.Error()}
+	}
+	if len(fraction) > 2 {
+		return 0, &ParseError{Text: text, Reason: "more than two decimals"}
+	}
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	cents, err := strconv.ParseInt(units+fraction, 10, 64)
+	if err != nil {
+		return 0, &ParseError{Text: text}
+	}
+	if negative {
+		cents = -cents
+	}
+	return Amount(cents), nil
+}
+
+func split(value string, decimal rune) (units, fraction string, err error) {
+	lastDot := strings.LastIndex(value, ".")
+	lastComma := strings.LastIndex(value, ",")
+	switch {
+	case decimal != 0:
+	case lastDot >= 0 && lastComma >= 0:
+		decimal = '.'
+		if lastComma > lastDot {
+			decimal = ','
+		}
+	case lastDot >= 0:
+		decimal, err = guessDecimal(value, '.', lastDot)
+	case lastComma >= 0:
+		decimal, err = guessDecimal(value, ',', lastComma)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	buf := strings.Builder{}
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			buf.WriteRune(r)
+		case r == decimal:
+			units = buf.String()
+			buf.Reset()
+			decimal = -1
+		case r == '.' || r == ',' || r == '\'' || unicode.IsSpace(r):
+			if decimal == -1 {
+				return "", "", fmt.Errorf("separator '%c' after the decimal point", r)
+			}
+		default:
+			return "", "", fmt.Errorf("unexpected character '%c'", r)
+		}
+	}
+	if decimal == -1 {
+		fraction = buf.String()
+	} else {
+		units = buf.String()
+	}
+	if units == "" && fraction == "" {
+		return "", "", fmt.Errorf("no digits")
+	}
+	if units == "" {
+		units = "0"
+	}
+	return units, fraction, nil
+}
+
+func guessDecimal(value string, separator rune, last int) (rune, error) {
+	if strings.Count(value, string(separator)) > 1 {
+		return 0, nil
+	}
+	if len(value)-last-1 == 3 {
+		return 0, fmt.Errorf("'%c' may be a decimal or a thousands separator; configure the decimal separator", separator)
+	}
+	return separator, nil
+}
@@ -0,0 +1,99 @@
+package money
+
+import (
+	"log"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range parseFixture {
+		got, err := Parse(test.text)
+		if got != test.expected || (err != nil) != test.err {
+			log.Println("fixture  ", i)
+			log.Println("text     ", test.text)
+			log.Println("expected ", test.expected, test.err)
+			log.Println("got      ", got, err)
+			t.FailNow()
+		}
+	}
+}
+
+var parseFixture = []struct {
+	text     string
+	expected Amount
+	err      bool
+}{
+	{"1234.56", 123456, false},
+	{"$1,234.56", 123456, false},
+	{"$50,000", 0, true},
+	{"$50,000.00", 5000000, false},
+	{"1,234,567", 123456700, false},
+	{"(1,234.56)", -123456, false},
+	{"1,234.56-", -123456, false},
+	{"-$12.5", -1250, false},
+	{"1.234,56 €", 123456, false},
+	{"1 234,56 $", 123456, false},
+	{"12,50", 1250, false},
+	{"CAD 99", 9900, false},
+	{"0.1", 10, false},
+	{".75", 75, false},
+	{"1.234", 0, true},
+	{"15.125", 0, true},
+	{"0.125", 0, true},
+	{"1.234.567", 123456700, false},
+	{"1.2345", 0, true},
+	{"12a", 0, true},
+	{"$", 0, true},
+}
+
+func TestParseDecimal(t *testing.T) {
+	for i, test := range parseDecimalFixture {
+		got, err := ParseDecimal(test.text, test.decimal)
+		if got != test.expected || (err != nil) != test.err {
+			log.Println("fixture  ", i)
+			log.Println("text     ", test.text, string(test.decimal))
+			log.Println("expected ", test.expected, test.err)
+			log.Println("got      ", got, err)
+			t.FailNow()
+		}
+	}
+}
+
+var parseDecimalFixture = []struct {
+	text     string
+	decimal  rune
+	expected Amount
+	err      bool
+}{
+	{"$50,000", '.', 5000000, false},
+	{"1.234", ',', 123400, false},
+	{"15,125", ',', 0, true},
+	{"15.125", '.', 0, true},
+	{"0.12", '.', 12, false},
+	{"1 234,5", ',', 123450, false},
+}
+
+func TestMul(t *testing.T) {
+	for i, test := range mulFixture {
+		got := test.amount.Mul(test.factor)
+		if got != test.expected {
+			log.Println("fixture  ", i)
+			log.Println("expected ", test.expected)
+			log.Println("got      ", got)
+			t.FailNow()
+		}
+	}
+}
+
+var mulFixture = []struct {
+	amount   Amount
+	factor   *big.Rat
+	expected Amount
+}{
+	{FromFloat(1923.08), big.NewRat(26, 1), 5000008},
+	{FromFloat(0.1), big.NewRat(3, 1), 30},
+	{FromFloat(25.55), new(big.Rat).SetFloat64(37.5), 95813},
+	{FromFloat(10), big.NewRat(1, 3), 333},
+	{FromFloat(-10), big.NewRat(2, 3), -667},
+}
@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/tokenizer"
+)
+
+type Form int
+
+const (
+	Plain Form = iota
+	If
+	Cond
+	Case
+)
+
+type Signature struct {
+	MinArgs, MaxArgs int
+	Form             Form
+}
+
+type argument struct {
+	start, end int
+}
+
+func (p *Parser) scanCalls() {
+	for _, rule := range p.rules {
+		for tokenIndex := rule.Body + 1; tokenIndex < rule.End; tokenIndex++ {
+			if p.tokens[tokenIndex].Type() != tokenizer.OpenParenthesis {
+				continue
+			}
+			opIndex := p.nextToken(tokenIndex+1, rule.End)
+			if opIndex < 0 || p.tokens[opIndex].Type() != tokenizer.Operation {
+				continue
+			}
+			signature, ok := p.signatures[p.tokens.Text(p.tokens[opIndex])]
+			if !ok {
+				continue
+			}
+			args, ok := p.arguments(opIndex+1, rule.End)
+			if !ok {
+				continue
+			}
+			p.checkCall(p.tokens[opIndex], signature, args)
+		}
+	}
+}
+
+func (p *Parser) nextToken(start, end int) int {
+	for i := start; i < end; i++ {
+		if p.tokens[i].Type() != tokenizer.Comment {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *Parser) arguments(start, end int) (result []argument, complete bool) {
+	for i := start; i < end; i++ {
+		switch p.tokens[i].Type() {
+		case tokenizer.Comment:
+		case tokenizer.Semicolon:
+			return result, false
+		case tokenizer.CloseParenthesis:
+			return result, true
+		case tokenizer.OpenParenthesis:
+			depth := 0
+			argStart := i
+			for ; i < end; i++ {
+				switch p.tokens[i].Type() {
+				case tokenizer.OpenParenthesis:
+					depth++
+				case tokenizer.CloseParenthesis:
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+			if i == end {
+				return result, false
+			}
+			result = append(result, argument{argStart, i + 1})
+		default:
+			result = append(result, argument{i, i + 1})
+		}
+	}
+	return result, false
+}
+
+func (p *Parser) checkCall(op tokenizer.Token, signature Signature, args []argument) {
+	name := p.tokens.Text(op)
+	if len(args) < signature.MinArgs {
+		p.report(op, WrongArity, "Operation '%v' expects at least %d argument(s), got %d", name, signature.MinArgs, len(args))
+		return
+	}
+	if signature.MaxArgs >= 0 && len(args) > signature.MaxArgs {
+		p.report(op, WrongArity, "Operation '%v' expects at most %d argument(s), got %d", name, signature.MaxArgs, len(args))
+		return
+	}
+
+	var conditions, branches []argument
+	switch signature.Form {
+	case If:
+		conditions, branches = args[:1], args[1:]
+	case Cond:
+		for i := 0; i+1 < len(args); i += 2 {
+			conditions = append(conditions, args[i])
+			branches = append(branches, args[i+1])
+		}
+		if len(args)%2 == 1 {
+			branches = append(branches, args[len(args)-1])
+		}
+	case Case:
+		for i := 1; i+1 < len(args); i += 2 {
+			branches = append(branches, args[i+1])
+		}
+		if len(args)%2 == 0 {
+			branches = append(branches, args[len(args)-1])
+		}
+	default:
+		return
+	}
+
+	for _, condition := range conditions {
+		token := p.tokens[condition.start]
+		if kind := p.argumentKind(token); kind != "" && kind != "boolean" && kind != "nil" {
+			p.report(token, BranchType, "Condition '%v' of '%v' is not a boolean", p.tokens.Text(token), name)
+		}
+	}
+	branchKind := ""
+	for _, branch := range branches {
+		token := p.tokens[branch.start]
+		kind := p.argumentKind(token)
+		if kind == "" || kind == "nil" {
+			continue
+		}
+		if branchKind == "" {
+			branchKind = kind
+		} else if kind != branchKind {
+			p.report(token, BranchType, "Branches of '%v' have different types: %v and %v", name, branchKind, kind)
+		}
+	}
+}
+
+func (p *Parser) argumentKind(token tokenizer.Token) string {
+	if token.Type() != tokenizer.CanonicalField {
+		return literalKind(token.Type())
+	}
+	switch p.metainfo.Type(p.tokens.Text(token)) {
+	case meta.String:
+		return "string"
+	case meta.Int, meta.Float, meta.Money:
+		return "number"
+	case meta.Bool:
+		return "boolean"
+	case meta.Date:
+		return "date"
+	}
+	return ""
+}
+
+func literalKind(tokenType tokenizer.TokenType) string {
+	switch tokenType {
+	case tokenizer.StringLiteral, tokenizer.Label:
+		return "string"
+	case tokenizer.IntegerLiteral, tokenizer.RealLiteral:
+		return "number"
+	case tokenizer.BooleanLiteral:
+		return "boolean"
+	case tokenizer.NilLiteral:
+		return "nil"
+	case tokenizer.DateLiteral, tokenizer.TodayLiteral:
+		return "date"
+	case tokenizer.DaySpanLiteral, tokenizer.MonthSpanLiteral, tokenizer.YearSpanLiteral:
+		return "span"
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"testing"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/tokenizer"
+)
+
+func TestCalls(t *testing.T) {
+	for i, params := range callFixture {
+		p := NewParser(
+			meta.Meta{"foo": meta.Int, "bar": meta.String, "baz": meta.Bool, "qux": meta.Date},
+			model.Set{"x": {}, "y": {}},
+			model.Set{"if": {}, "cond": {}, "case": {}, "fail": {}, "=": {}})
+		p.SetSignatures(map[string]Signature{
+			"if":   {MinArgs: 2, MaxArgs: 3, Form: If},
+			"cond": {MinArgs: 2, MaxArgs: -1, Form: Cond},
+			"case": {MinArgs: 3, MaxArgs: -1, Form: Case},
+			"fail": {MinArgs: 0, MaxArgs: -1},
+			"=":    {MinArgs: 2, MaxArgs: 2},
+		})
+		p.Parse(tokenizer.TokenizeString(params.rules))
+		var got []string
+		for _, d := range p.Diagnostics() {
+			if d.Code == WrongArity || d.Code == BranchType {
+				got = append(got, fmt.Sprintf("%d %s", d.Token.StartColumn(), d.Message))
+			}
+		}
+		if !reflect.DeepEqual(got, params.errors) {
+			log.Println("fixture  ", i)
+			log.Println("rules    ", params.rules)
+			log.Println("expected ", params.errors)
+			log.Println("got      ", got)
+			t.FailNow()
+		}
+	}
+}
+
+var callFixture = []struct {
+	rules  string
+	errors []string
+}{
+	{`bar = (if (= $x "T") $y nil);`, nil},
+	{`bar = (if (= $x "T") $y (fail "no"));`, nil},
+	{`bar = (if $x);`, []string{"7 Operation 'if' expects at least 2 argument(s), got 1"}},
+	{`bar = (if $x 1 2 3);`, []string{"7 Operation 'if' expects at most 3 argument(s), got 4"}},
+	{`bar = (= (= $x) $y);`, []string{"10 Operation '=' expects at least 2 argument(s), got 1"}},
+	{`bar = (if "yes" $x $y);`, []string{"10 Condition '\"yes\"' of 'if' is not a boolean"}},
+	{`foo = (if true 1 "one");`, []string{"17 Branches of 'if' have different types: number and string"}},
+	{`foo = (cond (= $x 1) 1 (= $x 2) 2.5 3);`, nil},
+	{`foo = (cond (= $x 1) 1 2 "two");`, []string{
+		"23 Condition '2' of 'cond' is not a boolean",
+		"25 Branches of 'cond' have different types: number and string",
+	}},
+	{`bar = (case $x A: "a" B: "b" "other");`, nil},
+	{`bar = (case $x A: "a" B: 2);`, []string{"25 Branches of 'case' have different types: string and number"}},
+	{`foo = (if baz foo 2);`, nil},
+	{`bar = (if baz qux "x");`, []string{"18 Branches of 'if' have different types: date and string"}},
+	{`bar = (if bar "x" "y");`, []string{"10 Condition 'bar' of 'if' is not a boolean"}},
+	{`foo = (cond baz 1 foo 2);`, []string{"18 Condition 'foo' of 'cond' is not a boolean"}},
+}
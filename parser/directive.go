@@ -0,0 +1,24 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+var modelDirective = regexp.MustCompile(`^#\s*model\s*:\s*(\S+)\s*$`)
+
+func ModelDirective(text string) (name string, line int) {
+	for i, row := range strings.Split(text, "\n") {
+		row = strings.TrimSpace(row)
+		if row == "" {
+			continue
+		}
+		if !strings.HasPrefix(row, "#") {
+			break
+		}
+		if match := modelDirective.FindStringSubmatch(row); match != nil {
+			return match[1], i
+		}
+	}
+	return "", -1
+}
@@ -0,0 +1,30 @@
+package parser
+
+import (
+	"log"
+	"testing"
+)
+
+func TestModelDirective(t *testing.T) {
+	for i, params := range directiveFixture {
+		name, line := ModelDirective(params.text)
+		if name != params.name || line != params.line {
+			log.Println("fixture  ", i)
+			log.Println("expected ", params.name, params.line)
+			log.Println("got      ", name, line)
+			t.FailNow()
+		}
+	}
+}
+
+var directiveFixture = []struct {
+	text string
+	name string
+	line int
+}{
+	{"# model: dependent\nfoo = $x;", "dependent", 0},
+	{"\n# Payroll feed\n#model:payroll_deduction\n", "payroll_deduction", 2},
+	{"foo = $x;\n# model: dependent", "", -1},
+	{"# modelling the dependents", "", -1},
+	{"", "", -1},
+}
@@ -0,0 +1,367 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/tokenizer"
+	"league.com/rulemaker/util"
+)
+
+type Node struct {
+	Rule   int
+	Name   string
+	Uses   []string
+	Inputs []string
+}
+
+type Graph []Node
+
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Edges []Edge
+
+func (p *Parser) buildGraph() {
+	p.graph = p.graph[:0]
+	for _, rule := range p.rules {
+		if rule.Field < 0 {
+			continue
+		}
+		node := Node{Rule: rule.Index, Name: p.tokens.Text(p.tokens[rule.Field])}
+		uses := model.Set{}
+		inputs := model.Set{}
+		for tokenIndex := rule.Head; tokenIndex < rule.End; tokenIndex++ {
+			token := p.tokens[tokenIndex]
+			text := p.tokens.Text(token)
+			switch token.Type() {
+			case tokenizer.CanonicalField:
+				for _, match := range inputSelector.FindAllStringSubmatch(text, -1) {
+					inputs[match[1]] = struct{}{}
+				}
+				if tokenIndex > rule.Body {
+					uses[text] = struct{}{}
+				}
+			case tokenizer.Variable:
+				if tokenIndex > rule.Body && !p.isPredefined(text) {
+					uses[text] = struct{}{}
+				}
+			case tokenizer.Input:
+				input, _ := token.Value().(string)
+				inputs[strings.Split(input, ":")[0]] = struct{}{}
+			}
+		}
+		node.Uses = sortedNames(uses)
+		node.Inputs = sortedNames(inputs)
+		p.graph = append(p.graph, node)
+	}
+}
+
+func (p *Parser) isPredefined(name string) bool {
+	_, ok := p.predefined[strings.SplitN(name, ".", 2)[0]]
+	return ok
+}
+
+func (g Graph) Definitions(name string) (result []int) {
+	key := definitionKey(name)
+	for i, node := range g {
+		definition := definitionKey(node.Name)
+		if definition == key || strings.HasPrefix(definition, key+".") || strings.HasPrefix(key, definition+".") {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func (g Graph) Dependencies(index int) (result []int) {
+	seen := map[int]struct{}{}
+	for _, name := range g[index].Uses {
+		for _, dependency := range g.Definitions(name) {
+			if _, ok := seen[dependency]; !ok {
+				seen[dependency] = struct{}{}
+				result = append(result, dependency)
+			}
+		}
+	}
+	return result
+}
+
+func (g Graph) Order() []int {
+	dependencies := make([][]int, len(g))
+	for i := range g {
+		dependencies[i] = g.Dependencies(i)
+	}
+	lastInSlice := map[string]int{}
+	for i, node := range g {
+		if root, ok := sliceRoot(node.Name); ok {
+			if previous, ok := lastInSlice[root]; ok {
+				dependencies[i] = append(dependencies[i], previous)
+			}
+			lastInSlice[root] = i
+		}
+	}
+
+	done := make([]bool, len(g))
+	var result []int
+	for len(result) < len(g) {
+		next := -1
+	nodes:
+		for i := range g {
+			if done[i] {
+				continue
+			}
+			for _, dependency := range dependencies[i] {
+				if !done[dependency] && dependency != i {
+					continue nodes
+				}
+			}
+			next = i
+			break
+		}
+		if next < 0 {
+			break
+		}
+		done[next] = true
+		result = append(result, next)
+	}
+	for i := range g {
+		if !done[i] {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func (g Graph) Cycles() (result [][]int) {
+	index := 0
+	indices := make([]int, len(g))
+	lowLinks := make([]int, len(g))
+	onStack := make([]bool, len(g))
+	for i := range indices {
+		indices[i] = -1
+	}
+	var stack []int
+	var connect func(node int)
+	connect = func(node int) {
+		indices[node] = index
+		lowLinks[node] = index
+		index++
+		stack = append(stack, node)
+		onStack[node] = true
+		selfLoop := false
+		for _, dependency := range g.Dependencies(node) {
+			if dependency == node {
+				selfLoop = true
+			} else if indices[dependency] < 0 {
+				connect(dependency)
+				if lowLinks[dependency] < lowLinks[node] {
+					lowLinks[node] = lowLinks[dependency]
+				}
+			} else if onStack[dependency] && indices[dependency] < lowLinks[node] {
+				lowLinks[node] = indices[dependency]
+			}
+		}
+		if lowLinks[node] != indices[node] {
+			return
+		}
+		var component []int
+		for {
+			last := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[last] = false
+			component = append([]int{last}, component...)
+			if last == node {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop {
+			result = append(result, component)
+		}
+	}
+	for i := range g {
+		if indices[i] < 0 {
+			connect(i)
+		}
+	}
+	return result
+}
+
+func (p *Parser) scanGraph() {
+	for _, cycle := range p.graph.Cycles() {
+		names := make([]string, len(cycle))
+		for i, node := range cycle {
+			names[i] = p.graph[node].Name
+		}
+		for _, node := range cycle {
+			token := p.tokens[p.rules[p.graph[node].Rule].Field]
+			if len(cycle) == 1 {
+				p.report(token, DependencyCycle, "'%v' depends on itself", names[0])
+			} else {
+				p.report(token, DependencyCycle, "Dependency cycle: %v -> %v", strings.Join(names, " -> "), names[0])
+			}
+		}
+	}
+
+	for _, rule := range p.rules {
+		for tokenIndex := rule.Body + 1; tokenIndex < rule.End; tokenIndex++ {
+			token := p.tokens[tokenIndex]
+			if token.Type() != tokenizer.CanonicalField && token.Type() != tokenizer.Variable {
+				continue
+			}
+			for _, definition := range p.graph.Definitions(p.tokens.Text(token)) {
+				if p.graph[definition].Rule > rule.Index {
+					p.warn(token, UseBeforeDefinition, "'%v' is used before its definition", p.tokens.Text(token))
+					break
+				}
+			}
+		}
+	}
+}
+
+func (p *Parser) OrderedRules() Rules {
+	result := make(Rules, 0, len(p.graph))
+	for _, node := range p.graph.Order() {
+		result = append(result, p.rules[p.graph[node].Rule])
+	}
+	return result
+}
+
+func definitionKey(name string) string {
+	var parts []string
+	for _, part := range meta.SplitPath(name) {
+		if selectorName, _, _, keyed := meta.ParseSelector(part); keyed {
+			parts = append(parts, selectorName, meta.UpdateLastElement)
+		} else if part == meta.AppendToSlice {
+			parts = append(parts, meta.UpdateLastElement)
+		} else {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func sliceRoot(name string) (string, bool) {
+	key := definitionKey(name)
+	if index := strings.Index(key, "."+meta.UpdateLastElement); index >= 0 {
+		return key[:index], true
+	}
+	return "", false
+}
+
+func (g Graph) Edges() (result Edges) {
+	seen := map[Edge]struct{}{}
+	add := func(edge Edge) {
+		if _, ok := seen[edge]; !ok {
+			seen[edge] = struct{}{}
+			result = append(result, edge)
+		}
+	}
+	for _, node := range g {
+		for _, input := range node.Inputs {
+			add(Edge{From: "$" + input, To: node.Name})
+		}
+		for _, name := range node.Uses {
+			definitions := g.Definitions(name)
+			if len(definitions) == 0 {
+				add(Edge{From: name, To: node.Name})
+			}
+			for _, definition := range definitions {
+				add(Edge{From: g[definition].Name, To: node.Name})
+			}
+		}
+	}
+	return result
+}
+
+func (e Edges) Downstream(name string) (result Edges) {
+	reached := map[string]struct{}{name: {}}
+	for changed := true; changed; {
+		changed = false
+		for _, edge := range e {
+			if _, ok := reached[edge.From]; !ok {
+				continue
+			}
+			if _, ok := reached[edge.To]; !ok {
+				reached[edge.To] = struct{}{}
+				changed = true
+			}
+		}
+	}
+	for _, edge := range e {
+		if _, ok := reached[edge.From]; ok {
+			result = append(result, edge)
+		}
+	}
+	return result
+}
+
+func (e Edges) Nodes() []string {
+	nodes := model.Set{}
+	var result []string
+	for _, edge := range e {
+		for _, name := range []string{edge.From, edge.To} {
+			if _, ok := nodes[name]; !ok {
+				nodes[name] = struct{}{}
+				result = append(result, name)
+			}
+		}
+	}
+	return result
+}
+
+func NodeKind(name string) string {
+	switch {
+	case strings.HasPrefix(name, "$"):
+		return "input"
+	case strings.HasPrefix(name, "_"):
+		return "variable"
+	}
+	return "field"
+}
+
+func (e Edges) DOT() string {
+	buf := strings.Builder{}
+	buf.WriteString("digraph rules {\n\trankdir=LR;\n")
+	for _, name := range e.Nodes() {
+		switch NodeKind(name) {
+		case "input":
+			fmt.Fprintf(&buf, "\t%q [shape=box];\n", name)
+		case "variable":
+			fmt.Fprintf(&buf, "\t%q [shape=ellipse, style=dashed];\n", name)
+		default:
+			fmt.Fprintf(&buf, "\t%q [shape=ellipse];\n", name)
+		}
+	}
+	for _, edge := range e {
+		fmt.Fprintf(&buf, "\t%q -> %q;\n", edge.From, edge.To)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+type jsonNode struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+func (e Edges) JSON() string {
+	graph := struct {
+		Nodes []jsonNode `json:"nodes"`
+		Edges Edges      `json:"edges"`
+	}{Nodes: []jsonNode{}, Edges: e}
+	if graph.Edges == nil {
+		graph.Edges = Edges{}
+	}
+	for _, name := range e.Nodes() {
+		graph.Nodes = append(graph.Nodes, jsonNode{Name: name, Kind: NodeKind(name)})
+	}
+	return util.ToJson(graph) + "\n"
+}
+
+func (n Node) String() string {
+	return fmt.Sprintf("%s <- %v %v", n.Name, n.Uses, n.Inputs)
+}
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"testing"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/tokenizer"
+)
+
+func TestGraph(t *testing.T) {
+	for i, params := range graphFixture {
+		p := NewParser(
+			meta.Meta{"foo": meta.Int, "bar": meta.String, "baz.+.name": meta.String, "baz.-.name": meta.String, "baz": meta.Slice},
+			model.Set{"x": {}, "y": {}},
+			model.Set{"quux": {}})
+		p.SetPredefined(model.Set{"_old": {}})
+		p.Parse(tokenizer.TokenizeString(params.rules))
+		var order []string
+		for _, rule := range p.OrderedRules() {
+			order = append(order, p.tokens.Text(p.tokens[rule.Field]))
+		}
+		var diagnostics []string
+		for _, d := range p.Diagnostics() {
+			if d.Code == UseBeforeDefinition || d.Code == DependencyCycle || d.Code == UndefinedField || d.Code == UndefinedVariable {
+				diagnostics = append(diagnostics, fmt.Sprintf("%s %s", d.Code.Name(), d.Message))
+			}
+		}
+		if !reflect.DeepEqual(order, params.order) || !reflect.DeepEqual(diagnostics, params.diagnostics) {
+			log.Println("fixture  ", i)
+			log.Println("rules    ", params.rules)
+			log.Println("expected ", params.order, params.diagnostics)
+			log.Println("got      ", order, diagnostics)
+			t.FailNow()
+		}
+	}
+}
+
+var graphFixture = []struct {
+	rules       string
+	order       []string
+	diagnostics []string
+}{
+	{"foo = $x; bar = foo;", []string{"foo", "bar"}, nil},
+	{"bar = foo; foo = $x;", []string{"foo", "bar"}, []string{"use-before-definition 'foo' is used before its definition"}},
+	{"bar = _a; _a = (quux foo); foo = $x;", []string{"foo", "_a", "bar"}, []string{
+		"use-before-definition '_a' is used before its definition",
+		"use-before-definition 'foo' is used before its definition",
+	}},
+	{"bar = baz.-.name; baz.+.name = $x;", []string{"baz.+.name", "bar"}, []string{
+		"use-before-definition 'baz.-.name' is used before its definition",
+	}},
+	{"baz.+.name = $x; baz.-.name = (quux bar); bar = $y;", []string{"baz.+.name", "bar", "baz.-.name"}, []string{
+		"use-before-definition 'bar' is used before its definition",
+	}},
+	{"bar = foo;", []string{"bar"}, []string{"undefined-field Canonical field 'foo' is not defined"}},
+	{"bar = _a;", []string{"bar"}, []string{"undefined-variable Variable '_a' is not defined"}},
+	{"bar = _old.bar;", []string{"bar"}, nil},
+	{"foo = (quux foo);", []string{"foo"}, []string{"dependency-cycle 'foo' depends on itself"}},
+	{"foo = bar; bar = foo;", []string{"foo", "bar"}, []string{
+		"dependency-cycle Dependency cycle: foo -> bar -> foo",
+		"use-before-definition 'bar' is used before its definition",
+		"dependency-cycle Dependency cycle: foo -> bar -> foo",
+	}},
+}
+
+func TestEdges(t *testing.T) {
+	p := NewParser(
+		meta.Meta{"foo": meta.Int, "bar": meta.String, "baz": meta.String},
+		model.Set{"x": {}, "y": {}},
+		model.Set{"quux": {}})
+	p.Parse(tokenizer.TokenizeString("_a = (quux $x $y); foo = _a; bar = (quux foo $y); baz = $y;"))
+	edges := p.Graph().Edges()
+	expected := Edges{
+		{From: "$x", To: "_a"},
+		{From: "$y", To: "_a"},
+		{From: "_a", To: "foo"},
+		{From: "$y", To: "bar"},
+		{From: "foo", To: "bar"},
+		{From: "$y", To: "baz"},
+	}
+	if !reflect.DeepEqual(edges, expected) {
+		log.Println("expected ", expected)
+		log.Println("got      ", edges)
+		t.FailNow()
+	}
+
+	dot := edges.Downstream("$x").DOT()
+	expectedDot := `digraph rules {
+	rankdir=LR;
+	"$x" [shape=box];
+	"_a" [shape=ellipse, style=dashed];
+	"foo" [shape=ellipse];
+	"bar" [shape=ellipse];
+	"$x" -> "_a";
+	"_a" -> "foo";
+	"foo" -> "bar";
+}
+`
+	if dot != expectedDot {
+		log.Println("expected ", expectedDot)
+		log.Println("got      ", dot)
+		t.FailNow()
+	}
+}
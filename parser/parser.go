@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -27,13 +28,95 @@ func (r Rule) String() string {
 	return fmt.Sprintf("<rule: %d-%d-%d>", r.Head, r.Body, r.End)
 }
 
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Info
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Info:
+		return "info"
+	}
+	return "unknown"
+}
+
+type Code string
+
+const (
+	UndefinedInput        Code = "R001"
+	UndefinedField        Code = "R002"
+	UndefinedVariable     Code = "R003"
+	UndefinedOperation    Code = "R004"
+	UseBeforeDefinition   Code = "R005"
+	MultipleDefinitions   Code = "R006"
+	InvalidToken          Code = "R007"
+	UnexpectedToken       Code = "R008"
+	IncompleteRule        Code = "R009"
+	MissingEqualSign      Code = "R010"
+	MissingOperation      Code = "R011"
+	UnbalancedParentheses Code = "R012"
+	ExtraneousToken       Code = "R013"
+	UnusedVariable        Code = "R014"
+	UnreadInput           Code = "R015"
+	UnassignedField       Code = "R016"
+	DependencyCycle       Code = "R017"
+	WrongArity            Code = "R018"
+	BranchType            Code = "R019"
+)
+
+var codeNames = map[Code]string{
+	UndefinedInput:        "undefined-input",
+	UndefinedField:        "undefined-field",
+	UndefinedVariable:     "undefined-variable",
+	UndefinedOperation:    "undefined-operation",
+	UseBeforeDefinition:   "use-before-definition",
+	MultipleDefinitions:   "multiple-definitions",
+	InvalidToken:          "invalid-token",
+	UnexpectedToken:       "unexpected-token",
+	IncompleteRule:        "incomplete-rule",
+	MissingEqualSign:      "missing-equal-sign",
+	MissingOperation:      "missing-operation",
+	UnbalancedParentheses: "unbalanced-parentheses",
+	ExtraneousToken:       "extraneous-token",
+	UnusedVariable:        "unused-variable",
+	UnreadInput:           "unread-input",
+	UnassignedField:       "unassigned-field",
+	DependencyCycle:       "dependency-cycle",
+	WrongArity:            "wrong-arity",
+	BranchType:            "branch-type",
+}
+
+func (c Code) Name() string {
+	return codeNames[c]
+}
+
+func (c Code) String() string {
+	return fmt.Sprintf("%s %s", string(c), c.Name())
+}
+
+type Edit struct {
+	Token tokenizer.Token
+	Text  string
+}
+
 type Diagnostic struct {
-	Token   tokenizer.Token
-	Message string
+	Token    tokenizer.Token
+	Severity Severity
+	Code     Code
+	Message  string
+	Edits    []Edit
 }
 
 func (d Diagnostic) String() string {
-	return fmt.Sprintf("%d:%d: %s", d.Token.Line(), d.Token.StartColumn(), d.Message)
+	return fmt.Sprintf("%d:%d: %s %s: %s", d.Token.Line(), d.Token.StartColumn(), d.Severity, d.Code, d.Message)
 }
 
 func NewParser(metainfo meta.Meta, inputs, operations model.Set) *Parser {
@@ -41,6 +124,10 @@ func NewParser(metainfo meta.Meta, inputs, operations model.Set) *Parser {
 		metainfo:   metainfo,
 		inputs:     inputs,
 		operations: operations,
+		required:   model.Set{},
+		declared:   model.Set{},
+		predefined: model.Set{},
+		signatures: map[string]Signature{},
 	}
 }
 
@@ -48,9 +135,15 @@ type Parser struct {
 	metainfo   meta.Meta
 	inputs     model.Set
 	operations model.Set
+	required   model.Set
+	declared   model.Set
+	predefined model.Set
+	merging    bool
+	signatures map[string]Signature
 
 	tokens      tokenizer.Tokens
 	rules       Rules
+	graph       Graph
 	diagnostics []Diagnostic
 	completions []string
 }
@@ -64,11 +157,35 @@ func (p *Parser) Parse(tokens tokenizer.Tokens) {
 	p.tokens = tokens
 	p.diagnostics = p.diagnostics[:0]
 	p.makeRules()
+	p.buildGraph()
 	p.scanDefinitions()
 	p.scanRules()
+	p.scanCalls()
+	p.scanGraph()
+	p.scanUsage()
 	p.sortDiagnostics()
 }
 
+func (p *Parser) SetRequired(fields model.Set) {
+	p.required = fields
+}
+
+func (p *Parser) SetDeclared(inputs model.Set) {
+	p.declared = inputs
+}
+
+func (p *Parser) SetMerging(merging bool) {
+	p.merging = merging
+}
+
+func (p *Parser) SetPredefined(variables model.Set) {
+	p.predefined = variables
+}
+
+func (p *Parser) SetSignatures(signatures map[string]Signature) {
+	p.signatures = signatures
+}
+
 func (p *Parser) makeRules() {
 	p.rules = p.rules[:0]
 	startIndex := 0
@@ -135,7 +252,7 @@ func (p *Parser) scanDefinitions() {
 	for field, ruleIndices := range definitions {
 		if len(ruleIndices) > 1 {
 			for _, ruleIndex := range ruleIndices {
-				p.report(p.tokens[p.rules[ruleIndex].Field], "Multiple definitions of '%v'", field)
+				p.report(p.tokens[p.rules[ruleIndex].Field], MultipleDefinitions, "Multiple definitions of '%v'", field)
 			}
 		}
 	}
@@ -152,12 +269,12 @@ func (p *Parser) scanRuleHead(rule Rule) {
 	for tokenIndex := rule.Head; tokenIndex < rule.Body; tokenIndex++ {
 		token := p.tokens[tokenIndex]
 		if token.Type() == tokenizer.InvalidToken {
-			p.report(token, "Invalid token '%v'", p.tokens.Text(token))
+			p.report(token, InvalidToken, "Invalid token '%v'", p.tokens.Text(token))
 		} else if token.Type() != tokenizer.Comment && tokenIndex != rule.Field {
-			p.report(token, "Unexpected token '%v'", p.tokens.Text(token))
+			p.report(token, UnexpectedToken, "Unexpected token '%v'", p.tokens.Text(token))
 		} else if token.Type() == tokenizer.CanonicalField {
 			if p.metainfo.Type(p.tokens.Text(token)) == meta.Invalid {
-				p.report(token, "Canonical model does not have field '%v'", p.tokens.Text(token))
+				p.suggest(token, UndefinedField, p.tokens.Text(token), p.fieldNames(), "Canonical model does not have field '%v'", p.tokens.Text(token))
 			}
 		}
 	}
@@ -167,13 +284,13 @@ func (p *Parser) scanRuleBody(rule Rule) {
 	if rule.Head == rule.Body || rule.Body == rule.End {
 		token := p.tokens[rule.Head]
 		if token.Type() != tokenizer.Comment {
-			p.report(token, "Incomplete rule")
+			p.report(token, IncompleteRule, "Incomplete rule")
 			return
 		}
 	}
 	firstToken := p.tokens[rule.Body]
 	if firstToken.Type() != tokenizer.EqualSign {
-		p.report(firstToken, "Missing '='")
+		p.report(firstToken, MissingEqualSign, "Missing '='")
 		return
 	}
 	var openParentheses tokenizer.Tokens
@@ -186,33 +303,37 @@ func (p *Parser) scanRuleBody(rule Rule) {
 		switch token.Type() {
 		case tokenizer.CanonicalField:
 			if p.metainfo.Type(p.tokens.Text(token)) == meta.Invalid {
-				p.report(token, "Canonical model does not have field '%v'", p.tokens.Text(token))
-			} else if index := p.firstDefinition(p.tokens.Text(token)); index < 0 && index >= rule.Index {
-				p.report(token, "Canonical field '%v' is not defined", p.tokens.Text(token))
+				p.suggest(token, UndefinedField, p.tokens.Text(token), p.fieldNames(), "Canonical model does not have field '%v'", p.tokens.Text(token))
+			} else if !p.merging && len(p.graph.Definitions(p.tokens.Text(token))) == 0 {
+				p.report(token, UndefinedField, "Canonical field '%v' is not defined", p.tokens.Text(token))
 			} else if bodyComplete {
-				p.report(token, "Extraneous token '%v'", p.tokens.Text(token))
+				p.report(token, ExtraneousToken, "Extraneous token '%v'", p.tokens.Text(token))
 			} else if len(openParentheses) == 0 {
 				bodyComplete = true
 			}
 		case tokenizer.Variable:
-			if index := p.firstDefinition(p.tokens.Text(token)); index < 0 && index >= rule.Index {
-				p.report(token, "Variable '%v' is not defined", p.tokens.Text(token))
+			if !p.isPredefined(p.tokens.Text(token)) && len(p.graph.Definitions(p.tokens.Text(token))) == 0 {
+				p.suggest(token, UndefinedVariable, p.tokens.Text(token), p.variables(), "Variable '%v' is not defined", p.tokens.Text(token))
 			} else if bodyComplete {
-				p.report(token, "Extraneous token '%v'", p.tokens.Text(token))
+				p.report(token, ExtraneousToken, "Extraneous token '%v'", p.tokens.Text(token))
 			} else if len(openParentheses) == 0 {
 				bodyComplete = true
 			}
 		case tokenizer.Operation:
 			if _, defined := p.operations[p.tokens.Text(token)]; !defined {
-				p.report(token, "Operation '%v' is not defined", p.tokens.Text(token))
+				p.suggest(token, UndefinedOperation, p.tokens.Text(token), sortedNames(p.operations), "Operation '%v' is not defined", p.tokens.Text(token))
 			}
 		case tokenizer.Input:
 			input, _ := token.Value().(string)
 			inputParts := strings.Split(input, ":")
 			if _, defined := p.inputs[inputParts[0]]; !defined {
-				p.report(token, "Input field '%v' is not defined", p.tokens.Text(token))
+				var candidates []string
+				for _, name := range sortedNames(p.inputs) {
+					candidates = append(candidates, strings.Join(append([]string{"$" + name}, inputParts[1:]...), ":"))
+				}
+				p.suggest(token, UndefinedInput, p.tokens.Text(token), candidates, "Input field '%v' is not defined", p.tokens.Text(token))
 			} else if bodyComplete {
-				p.report(token, "Extraneous token '%v'", p.tokens.Text(token))
+				p.report(token, ExtraneousToken, "Extraneous token '%v'", p.tokens.Text(token))
 			} else if len(openParentheses) == 0 {
 				bodyComplete = true
 			}
@@ -228,13 +349,13 @@ func (p *Parser) scanRuleBody(rule Rule) {
 				break
 			}
 			if nextToken == nil || nextToken.Type() == tokenizer.OpenParenthesis || nextToken.Type() == tokenizer.CloseParenthesis {
-				p.report(token, "Missing operation")
+				p.report(token, MissingOperation, "Missing operation")
 			} else if nextToken.Type() != tokenizer.Operation {
-				p.report(*nextToken, "Missing operation")
+				p.report(*nextToken, MissingOperation, "Missing operation")
 			}
 		case tokenizer.CloseParenthesis:
 			if len(openParentheses) == 0 {
-				p.report(token, "Unbalanced ')'")
+				p.report(token, UnbalancedParentheses, "Unbalanced ')'")
 			} else {
 				openParentheses = openParentheses[:len(openParentheses)-1]
 				if len(openParentheses) == 0 {
@@ -242,11 +363,11 @@ func (p *Parser) scanRuleBody(rule Rule) {
 				}
 			}
 		case tokenizer.EqualSign:
-			p.report(token, "Unexpected '='")
+			p.report(token, UnexpectedToken, "Unexpected '='")
 		default:
 			if token.Type() != tokenizer.Comment {
 				if bodyComplete {
-					p.report(token, "Extraneous token '%v'", p.tokens.Text(token))
+					p.report(token, ExtraneousToken, "Extraneous token '%v'", p.tokens.Text(token))
 				} else if len(openParentheses) == 0 {
 					bodyComplete = true
 				}
@@ -254,35 +375,190 @@ func (p *Parser) scanRuleBody(rule Rule) {
 		}
 	}
 	for _, openParenthesis := range openParentheses {
-		p.report(openParenthesis, "Unbalanced '('")
+		p.report(openParenthesis, UnbalancedParentheses, "Unbalanced '('")
 	}
 }
 
-func (p *Parser) firstDefinition(name string) int {
+var inputSelector = regexp.MustCompile(`=\$(\w+)`)
+
+func (p *Parser) scanUsage() {
+	variables := model.Set{}
+	inputs := model.Set{}
+	var assigned []string
 	for _, rule := range p.rules {
-		if rule.Field >= 0 {
-			if p.tokens.Text(p.tokens[rule.Field]) == name {
-				return rule.Index
+		for tokenIndex := rule.Head; tokenIndex < rule.End; tokenIndex++ {
+			token := p.tokens[tokenIndex]
+			switch token.Type() {
+			case tokenizer.Variable:
+				if tokenIndex != rule.Field {
+					variables[p.tokens.Text(token)] = struct{}{}
+				}
+			case tokenizer.Input:
+				input, _ := token.Value().(string)
+				inputs[strings.Split(input, ":")[0]] = struct{}{}
+			case tokenizer.CanonicalField:
+				for _, match := range inputSelector.FindAllStringSubmatch(p.tokens.Text(token), -1) {
+					inputs[match[1]] = struct{}{}
+				}
+				if tokenIndex == rule.Field {
+					assigned = append(assigned, p.tokens.Text(token))
+				}
 			}
 		}
 	}
-	return -1
+
+	for _, rule := range p.rules {
+		if rule.Field < 0 {
+			continue
+		}
+		token := p.tokens[rule.Field]
+		if _, used := variables[p.tokens.Text(token)]; token.Type() == tokenizer.Variable && !used {
+			p.warn(token, UnusedVariable, "Variable '%v' is defined but never used", p.tokens.Text(token))
+		}
+	}
+
+	fileToken := p.tokens[len(p.tokens)-1]
+	for _, input := range sortedNames(p.declared) {
+		if _, used := inputs[input]; !used {
+			p.inform(fileToken, UnreadInput, "Input field '$%v' is never read", input)
+		}
+	}
+	for _, field := range sortedNames(p.required) {
+		if !isAssigned(field, assigned) {
+			p.warn(fileToken, UnassignedField, "Required field '%v' is not assigned", field)
+		}
+	}
+}
+
+func isAssigned(field string, assigned []string) bool {
+	for _, path := range assigned {
+		if path == field || strings.HasPrefix(path, field+".") || strings.HasPrefix(path, field+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedNames(set model.Set) []string {
+	result := make([]string, 0, len(set))
+	for name := range set {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (p *Parser) report(token tokenizer.Token, code Code, message string, args ...interface{}) {
+	p.add(Diagnostic{Token: token, Severity: Error, Code: code, Message: fmt.Sprintf(message, args...)})
 }
 
-func (p *Parser) report(token tokenizer.Token, message string, args ...interface{}) {
+func (p *Parser) warn(token tokenizer.Token, code Code, message string, args ...interface{}) {
+	p.add(Diagnostic{Token: token, Severity: Warning, Code: code, Message: fmt.Sprintf(message, args...)})
+}
+
+func (p *Parser) inform(token tokenizer.Token, code Code, message string, args ...interface{}) {
+	p.add(Diagnostic{Token: token, Severity: Info, Code: code, Message: fmt.Sprintf(message, args...)})
+}
+
+func (p *Parser) suggest(token tokenizer.Token, code Code, name string, candidates []string, message string, args ...interface{}) {
+	d := Diagnostic{Token: token, Severity: Error, Code: code, Message: fmt.Sprintf(message, args...)}
+	for _, candidate := range closest(name, candidates) {
+		d.Edits = append(d.Edits, Edit{Token: token, Text: candidate})
+	}
+	if len(d.Edits) > 0 {
+		d.Message += fmt.Sprintf("; did you mean '%v'?", d.Edits[0].Text)
+	}
+	p.add(d)
+}
+
+func (p *Parser) add(diagnostic Diagnostic) {
 	for _, d := range p.diagnostics {
-		if d.Token.Line() == token.Line() && d.Token.StartColumn() == token.StartColumn() {
-			return
+		if d.Token.Line() == diagnostic.Token.Line() && d.Token.StartColumn() == diagnostic.Token.StartColumn() {
+			if d.Severity == Error && diagnostic.Severity == Error || d.Message == diagnostic.Message {
+				return
+			}
 		}
 	}
-	p.diagnostics = append(p.diagnostics, Diagnostic{
-		Token:   token,
-		Message: fmt.Sprintf(message, args...),
-	})
+	p.diagnostics = append(p.diagnostics, diagnostic)
+}
+
+func (p *Parser) fieldNames() []string {
+	result := make([]string, 0, len(p.metainfo))
+	for name := range p.metainfo {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (p *Parser) variables() (result []string) {
+	for _, rule := range p.rules {
+		if rule.Field >= 0 && p.tokens[rule.Field].Type() == tokenizer.Variable {
+			result = append(result, p.tokens.Text(p.tokens[rule.Field]))
+		}
+	}
+	return result
+}
+
+const maxSuggestions = 3
+
+func closest(name string, candidates []string) []string {
+	maxDistance := len(name) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	distances := map[string]int{}
+	var result []string
+	for _, candidate := range candidates {
+		if _, seen := distances[candidate]; seen || candidate == name {
+			continue
+		}
+		distance := editDistance(name, candidate)
+		if distance <= maxDistance {
+			distances[candidate] = distance
+			result = append(result, candidate)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return distances[result[i]] < distances[result[j]] })
+	if len(result) > maxSuggestions {
+		result = result[:maxSuggestions]
+	}
+	return result
+}
+
+func editDistance(a, b string) int {
+	one, two := []rune(a), []rune(b)
+	previous := make([]int, len(two)+1)
+	current := make([]int, len(two)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(one); i++ {
+		current[0] = i
+		for j := 1; j <= len(two); j++ {
+			cost := 1
+			if one[i-1] == two[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(two)]
+}
+
+func min(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
 }
 
 func (p *Parser) sortDiagnostics() {
-	sort.Slice(p.diagnostics, func(i, j int) bool {
+	sort.SliceStable(p.diagnostics, func(i, j int) bool {
 		if p.diagnostics[i].Token.Line() < p.diagnostics[j].Token.Line() {
 			return true
 		}
@@ -297,6 +573,23 @@ func (p *Parser) Diagnostics() []Diagnostic {
 	return p.diagnostics
 }
 
+func (p *Parser) HasErrors() bool {
+	for _, d := range p.diagnostics {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) Graph() Graph {
+	return p.graph
+}
+
+func (p *Parser) Rules() Rules {
+	return p.rules
+}
+
 func (p *Parser) Completions(line, column int) []Completion {
 	var rule Rule
 	for _, rule = range p.rules {
@@ -130,3 +130,92 @@ var fixture = []struct {
 	{"foo = $x; bar = $a;", nil},
 	{"foo = (((;", nil},
 }
+
+func TestWarnings(t *testing.T) {
+	for i, params := range warningFixture {
+		p := NewParser(
+			meta.Meta{"foo": meta.Int, "bar": meta.String, "baz.-.name": meta.String, "baz.+.name": meta.String, "baz": meta.Slice},
+			model.Set{"x": {}, "y": {}},
+			model.Set{"quux": {}})
+		p.SetRequired(model.Set{"foo": {}, "baz": {}})
+		p.SetDeclared(model.Set{"x": {}, "y": {}})
+		p.Parse(tokenizer.TokenizeString(params.rules))
+		got := []string{}
+		for _, d := range p.Diagnostics() {
+			if d.Severity != Error {
+				got = append(got, d.Message)
+			}
+		}
+		if !reflect.DeepEqual(got, params.warnings) || p.HasErrors() {
+			log.Println("fixture  ", i)
+			log.Println("rules    ", params.rules)
+			log.Println("expected ", params.warnings)
+			log.Println("got      ", p.Diagnostics())
+			t.FailNow()
+		}
+	}
+
+	p := NewParser(meta.Meta{"foo": meta.Int}, model.Set{"x": {}, "y": {}, "z": {}}, model.Set{})
+	p.Parse(tokenizer.TokenizeString("foo = $x;"))
+	if len(p.Diagnostics()) > 0 {
+		log.Println("inputs that no census declares should not be reported:", p.Diagnostics())
+		t.FailNow()
+	}
+	p.SetDeclared(model.Set{"x": {}, "y": {}})
+	p.Parse(tokenizer.TokenizeString("foo = $x;"))
+	if d := p.Diagnostics(); len(d) != 1 || d[0].Severity != Info || d[0].Code != UnreadInput {
+		log.Println("expected an unread input info, got", d)
+		t.FailNow()
+	}
+}
+
+var warningFixture = []struct {
+	rules    string
+	warnings []string
+}{
+	{"foo = $x; baz.+.name = $y;", []string{}},
+	{"foo = $x; baz[name=$y].name = \"a\";", []string{}},
+	{"_a = $x; foo = _a; baz.+.name = $y;", []string{}},
+	{"_a = $x; foo = $y; baz.+.name = $y;", []string{"Variable '_a' is defined but never used"}},
+	{"foo = $x; bar = \"a\";", []string{
+		"Input field '$y' is never read",
+		"Required field 'baz' is not assigned",
+	}},
+}
+
+func TestSuggestions(t *testing.T) {
+	for i, params := range suggestionFixture {
+		p := NewParser(
+			meta.Meta{"province_of_employment": meta.String, "province": meta.String, "city": meta.String},
+			model.Set{"province_state": {}, "city": {}},
+			model.Set{"join": {}, "max": {}})
+		p.Parse(tokenizer.TokenizeString(params.rules))
+		var got []string
+		for _, d := range p.Diagnostics() {
+			if d.Code == params.code {
+				for _, edit := range d.Edits {
+					got = append(got, edit.Text)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, params.edits) {
+			log.Println("fixture  ", i)
+			log.Println("rules    ", params.rules)
+			log.Println("expected ", params.edits)
+			log.Println("got      ", p.Diagnostics())
+			t.FailNow()
+		}
+	}
+}
+
+var suggestionFixture = []struct {
+	rules string
+	code  Code
+	edits []string
+}{
+	{"province_of_employmnt = $city;", UndefinedField, []string{"province_of_employment"}},
+	{"city = $province_stat:string;", UndefinedInput, []string{"$province_state:string"}},
+	{"city = (jion $city);", UndefinedOperation, []string{"join"}},
+	{"_temp = $city; city = _tmp;", UndefinedVariable, []string{"_temp"}},
+	{"city = $zzzzzz;", UndefinedInput, nil},
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/tokenizer"
+)
+
+func (p *Parser) Symbol(line, column int) (tokenizer.Token, bool) {
+	var result tokenizer.Token
+	found := false
+	for _, token := range p.tokens {
+		switch token.Type() {
+		case tokenizer.Variable, tokenizer.CanonicalField, tokenizer.Input:
+		default:
+			continue
+		}
+		if token.Contains(line, column) {
+			return token, true
+		}
+		if token.Line() == line && token.EndColumn() == column {
+			result, found = token, true
+		}
+	}
+	return result, found
+}
+
+func (p *Parser) Rename(line, column int, name string) ([]Edit, error) {
+	symbol, ok := p.Symbol(line, column)
+	if !ok {
+		return nil, fmt.Errorf("only variables, canonical fields and inputs can be renamed")
+	}
+	if symbol.Type() == tokenizer.Input && !strings.HasPrefix(name, "$") {
+		name = "$" + name
+	}
+	tokens := tokenizer.TokenizeString(name)
+	if len(tokens) != 2 || tokens[0].Type() != symbol.Type() || tokens.Text(tokens[0]) != name || symbolName(tokens[0], tokens) != name {
+		return nil, fmt.Errorf("'%s' is not a valid %s name", name, symbolKind(symbol.Type()))
+	}
+	oldName := symbolName(symbol, p.tokens)
+	if name == oldName {
+		return nil, nil
+	}
+	if _, ok := p.predefined[name]; ok && symbol.Type() == tokenizer.Variable {
+		return nil, fmt.Errorf("'%s' is a predefined variable", name)
+	}
+	if symbol.Type() == tokenizer.CanonicalField && p.metainfo.Type(name) == meta.Invalid {
+		return nil, fmt.Errorf("canonical model does not have field '%s'", name)
+	}
+	if _, ok := p.inputs[name[1:]]; !ok && symbol.Type() == tokenizer.Input {
+		return nil, fmt.Errorf("input '%s' is not defined", name)
+	}
+	if symbol.Type() == tokenizer.Input {
+		for _, token := range p.tokens {
+			if token.Type() == tokenizer.Input && symbolName(token, p.tokens) == name || token.Type() == tokenizer.CanonicalField && strings.Contains(p.tokens.Text(token), "="+name+"]") {
+				return nil, fmt.Errorf("input '%s' is already used on line %d", name, token.Line()+1)
+			}
+		}
+	}
+	for _, rule := range p.rules {
+		if rule.Field >= 0 && p.tokens[rule.Field].Type() == symbol.Type() && p.tokens.Text(p.tokens[rule.Field]) == name {
+			return nil, fmt.Errorf("'%s' is already defined on line %d", name, p.tokens[rule.Field].Line()+1)
+		}
+	}
+	var result []Edit
+	for _, token := range p.tokens {
+		text := p.tokens.Text(token)
+		if token.Type() == symbol.Type() && symbolName(token, p.tokens) == oldName {
+			result = append(result, Edit{Token: token, Text: name + text[len(oldName):]})
+		} else if token.Type() == tokenizer.CanonicalField && symbol.Type() == tokenizer.Input && strings.Contains(text, "="+oldName+"]") {
+			result = append(result, Edit{Token: token, Text: strings.ReplaceAll(text, "="+oldName+"]", "="+name+"]")})
+		} else if token.Type() == tokenizer.Variable && symbol.Type() == tokenizer.CanonicalField {
+			if text, ok := p.renamePath(p.tokens.Text(token), oldName, name); ok {
+				result = append(result, Edit{Token: token, Text: text})
+			}
+		}
+	}
+	return result, nil
+}
+
+func symbolName(token tokenizer.Token, tokens tokenizer.Tokens) string {
+	text := tokens.Text(token)
+	if token.Type() == tokenizer.Input {
+		if i := strings.Index(text, ":"); i >= 0 {
+			return text[:i]
+		}
+	}
+	return text
+}
+
+func (p *Parser) renamePath(text, oldName, name string) (string, bool) {
+	parts := strings.SplitN(text, ".", 2)
+	if _, ok := p.predefined[parts[0]]; !ok || len(parts) < 2 {
+		return "", false
+	}
+	if parts[1] == oldName {
+		return parts[0] + "." + name, true
+	}
+	if strings.HasPrefix(parts[1], oldName+".") {
+		return parts[0] + "." + name + parts[1][len(oldName):], true
+	}
+	return "", false
+}
+
+func symbolKind(tokenType tokenizer.TokenType) string {
+	switch tokenType {
+	case tokenizer.Variable:
+		return "variable"
+	case tokenizer.Input:
+		return "input"
+	}
+	return "canonical field"
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/tokenizer"
+)
+
+func TestRename(t *testing.T) {
+	for i, params := range renameFixture {
+		p := NewParser(
+			meta.Meta{"foo": meta.Int, "bar": meta.String, "qux": meta.String},
+			model.Set{"x": {}, "y": {}, "z": {}},
+			model.Set{"concat": {}})
+		p.SetPredefined(model.Set{"_today": {}, "_old": {}, "_new": {}, "_previous": {}})
+		p.Parse(tokenizer.TokenizeString(params.rules))
+		edits, err := p.Rename(params.line, params.column, params.name)
+		got := ""
+		if err != nil {
+			got = fmt.Sprint("error: ", err)
+		} else {
+			lines := strings.Split(params.rules, "\n")
+			for i := len(edits) - 1; i >= 0; i-- {
+				edit := edits[i]
+				runes := []rune(lines[edit.Token.Line()])
+				lines[edit.Token.Line()] = string(runes[:edit.Token.StartColumn()]) + edit.Text + string(runes[edit.Token.EndColumn():])
+			}
+			got = strings.Join(lines, "\n")
+		}
+		if got != params.expected {
+			log.Println("fixture  ", i)
+			log.Println("expected ", params.expected)
+			log.Println("got      ", got)
+			t.FailNow()
+		}
+	}
+}
+
+var renameFixture = []struct {
+	rules        string
+	line, column int
+	name         string
+	expected     string
+}{
+	{"_a = $x;\nfoo = (concat _a \"_a\");\nbar = _a;", 0, 0, "_b", "_b = $x;\nfoo = (concat _b \"_a\");\nbar = _b;"},
+	{"_a = $x;\nfoo = (concat _a \"_a\");\nbar = _a;", 2, 8, "_b", "_b = $x;\nfoo = (concat _b \"_a\");\nbar = _b;"},
+	{"_a = $x;\n_b = $y;\nfoo = _a;", 2, 6, "_b", "error: '_b' is already defined on line 2"},
+	{"_a = $x;\nfoo = _a;", 0, 0, "_today", "error: '_today' is a predefined variable"},
+	{"_a = $x;\nfoo = _a;", 0, 0, "b", "error: 'b' is not a valid variable name"},
+	{"_a = $x;\nfoo = _a;", 0, 0, "_b c", "error: '_b c' is not a valid variable name"},
+	{"foo = $x;\nbar = (concat $x \"$x\" $xx);", 1, 15, "z", "foo = $z;\nbar = (concat $z \"$x\" $xx);"},
+	{"foo = $x;\nbar = $y;", 0, 6, "$y", "error: input '$y' is already used on line 2"},
+	{"foo = $x;\nbar = foo;", 0, 1, "qux", "qux = $x;\nbar = qux;"},
+	{"foo = $x;\nbar = foo;", 0, 3, "bar", "error: 'bar' is already defined on line 2"},
+	{"foo = (concat $x);", 0, 8, "join", "error: only variables, canonical fields and inputs can be renamed"},
+	{"foo = $x;", 0, 6, "$x", "foo = $x;"},
+	{"bar = $x;\nbar = (concat _old.bar _new.bar _previous.bar _old.barn _today);", 0, 1, "qux", "qux = $x;\nqux = (concat _old.qux _new.qux _previous.qux _old.barn _today);"},
+	{"foo = $x;\nbar = foo;", 0, 1, "no_such_field", "error: canonical model does not have field 'no_such_field'"},
+	{"foo = $x;", 0, 6, "$no_such_input", "error: input '$no_such_input' is not defined"},
+	{"foo = $x:int;\nbar = $x;\nqux[foo=$x].bar = $x:date;", 1, 6, "$z", "foo = $z:int;\nbar = $z;\nqux[foo=$z].bar = $z:date;"},
+	{"foo = $x:int;\nbar = $y:int;", 0, 6, "$y", "error: input '$y' is already used on line 2"},
+	{"foo = $x;\nqux[foo=$y].bar = $z;", 0, 6, "$y", "error: input '$y' is already used on line 2"},
+	{"foo = $x;", 0, 6, "$z:int", "error: '$z:int' is not a valid input name"},
+}
@@ -4,9 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"league.com/rulemaker/canonical_model"
 	"league.com/rulemaker/content"
+	"league.com/rulemaker/engine"
 	"league.com/rulemaker/meta"
 	"league.com/rulemaker/model"
 	"league.com/rulemaker/style"
@@ -14,90 +16,148 @@ import (
 )
 
 var (
-	lightFlag = flag.Bool("light", false, "Light theme")
-	darkFlag  = flag.Bool("dark", false, "Dark theme")
+	lightFlag       = flag.Bool("light", false, "Light theme")
+	darkFlag        = flag.Bool("dark", false, "Dark theme")
+	sampleFlag      = flag.String("sample", "", "Sample input file to preview rule output")
+	todayFlag       = flag.String("today", "", "Date to use for 'today' in rules, as YYYY-MM-DD")
+	customFlag      = flag.String("custom", "", "JSON schema of the client's custom fields")
+	hashFlag        = flag.Bool("hash", false, "Hash sensitive fields instead of masking them")
+	unmaskFlag      = flag.Bool("unmask", false, "Show sensitive fields in clear text, for authorized debugging only")
+	constraintsFlag = flag.String("constraints", "", "JSON file of cross-field constraints checked after mapping")
+	validatorsFlag  = flag.String("validators", "", "JSON file of field validators that add to or override the models' own")
+	modelsFlag      = flag.String("models", "", "Comma-separated JSON Schema files of additional canonical models")
 )
 
+const customFieldsRoot = "custom_fields"
+
+var inputs = model.Set{
+	"policy":                        {},
+	"sin":                           {},
+	"employee_id":                   {},
+	"last_name":                     {},
+	"given_names":                   {},
+	"person_type":                   {},
+	"effective_date":                {},
+	"transaction_date":              {},
+	"division":                      {},
+	"benefit_class":                 {},
+	"administrative_class":          {},
+	"retirement_date":               {},
+	"termination_date":              {},
+	"deceased_date":                 {},
+	"birth_date":                    {},
+	"gender":                        {},
+	"language":                      {},
+	"street":                        {},
+	"city":                          {},
+	"province_state":                {},
+	"postal_zip_code":               {},
+	"foreign_country":               {},
+	"hire_date":                     {},
+	"province_of_employment":        {},
+	"province_of_residence":         {},
+	"employee_smoker":               {},
+	"business_location":             {},
+	"cost_centre":                   {},
+	"tax_exempt":                    {},
+	"does_employee_have_dependants": {},
+	"spouse_or_common_law_spouse":   {},
+	"num_of_dependants":             {},
+	"bank_transit_id":               {},
+	"bank_number":                   {},
+	"bank_account_number":           {},
+	"earnings_amount":               {},
+	"earnings_frequency":            {},
+	"dependant_name_on_drug_card":   {},
+	"revision_reason":               {},
+	"created_by":                    {},
+}
+
 func main() {
 	flag.Parse()
-	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	var schema meta.Meta
+	if *customFlag != "" {
+		var e error
+		schema, e = meta.ReadSchema(*customFlag)
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+			os.Exit(1)
+		}
+	}
+	models := meta.Models{}
+	for name, c := range canonical_model.Models {
+		m := meta.NewModel(name, c.Entity, c.IdField)
+		m.Constraints = append(m.Constraints, c.Constraints...)
+		models[name] = m
+	}
+	if *modelsFlag != "" {
+		for _, path := range strings.Split(*modelsFlag, ",") {
+			m, e := meta.ReadJSONSchema(path)
+			if e != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", e)
+				os.Exit(1)
+			}
+			models[m.Name] = m
+		}
+	}
+	var validators meta.Validators
+	if *validatorsFlag != "" {
+		var e error
+		validators, e = meta.ReadValidators(*validatorsFlag)
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+			os.Exit(1)
+		}
+	}
+	var constraints model.Constraints
+	if *constraintsFlag != "" {
+		var e error
+		constraints, e = meta.ReadConstraints(*constraintsFlag)
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+			os.Exit(1)
+		}
+	}
+	for name, m := range models {
+		if _, ok := m.Metainfo[customFieldsRoot+"."+meta.EntityMap]; ok && schema != nil {
+			m = m.WithSchema(customFieldsRoot, schema)
+		}
+		m.Validators = m.Validators.Merge(validators.ForModel(name, m.Metainfo))
+		if e := m.Validators.Prepare(m.Metainfo); e != nil {
+			fmt.Fprintf(os.Stderr, "model %s: %v\n", name, e)
+			os.Exit(1)
+		}
+		m.Constraints = append(append(model.Constraints{}, m.Constraints...), meta.ConstraintsForModel(constraints, name, m.Metainfo)...)
+		if e := meta.PrepareConstraints(m.Constraints, m.Metainfo); e != nil {
+			fmt.Fprintf(os.Stderr, "model %s: %v\n", name, e)
+			os.Exit(1)
+		}
+		models[name] = m
+	}
 
-	var inputs = model.Set{
-		"policy":                        {},
-		"sin":                           {},
-		"employee_id":                   {},
-		"last_name":                     {},
-		"given_names":                   {},
-		"person_type":                   {},
-		"effective_date":                {},
-		"transaction_date":              {},
-		"division":                      {},
-		"benefit_class":                 {},
-		"administrative_class":          {},
-		"retirement_date":               {},
-		"termination_date":              {},
-		"deceased_date":                 {},
-		"birth_date":                    {},
-		"gender":                        {},
-		"language":                      {},
-		"street":                        {},
-		"city":                          {},
-		"province_state":                {},
-		"postal_zip_code":               {},
-		"foreign_country":               {},
-		"hire_date":                     {},
-		"province_of_employment":        {},
-		"province_of_residence":         {},
-		"employee_smoker":               {},
-		"business_location":             {},
-		"cost_centre":                   {},
-		"tax_exempt":                    {},
-		"does_employee_have_dependants": {},
-		"spouse_or_common_law_spouse":   {},
-		"num_of_dependants":             {},
-		"bank_transit_id":               {},
-		"bank_number":                   {},
-		"bank_account_number":           {},
-		"earnings_amount":               {},
-		"earnings_frequency":            {},
-		"dependant_name_on_drug_card":   {},
-		"revision_reason":               {},
-		"created_by":                    {},
+	if *unmaskFlag {
+		fmt.Fprintf(os.Stderr, "warning: sensitive fields are not masked\n")
 	}
 
-	var operations = model.Set{
-		"strip_prefix":        {},
-		"strip_leading_zeros": {},
-		"first_of":            {},
-		"map":                 {},
-		"select":              {},
-		"all":                 {},
-		"any":                 {},
-		"one_of":              {},
-		"join":                {},
-		"+":                   {},
-		"*":                   {},
-		"=":                   {},
-		"!=":                  {},
-		"<":                   {},
-		">":                   {},
-		"<=":                  {},
-		">=":                  {},
-		"min":                 {},
-		"max":                 {},
-		"has":                 {},
-		"first_of_month":      {},
-		"weekly_hours":        {},
-		"config":              {},
-		"fail":                {},
-		"log":                 {},
-		"ticket":              {},
-		"contains":            {},
-		"skip":                {},
+	switch flag.Arg(0) {
+	case "check":
+		os.Exit(runCheck(models, flag.Args()[1:]))
+	case "graph":
+		os.Exit(runGraph(models, flag.Args()[1:]))
+	case "run":
+		os.Exit(runIngest(models, flag.Args()[1:]))
+	case "schema":
+		os.Exit(runSchema(models, flag.Args()[1:]))
+	case "test":
+		os.Exit(runTests(models, flag.Args()[1:]))
+	case "golden":
+		os.Exit(runGolden(models, flag.Args()[1:]))
+	case "history":
+		os.Exit(runHistory(flag.Args()[1:]))
 	}
 
 	// c, e := content.NewContent("test.rules")
-	c, e := content.NewFileContent("emp.rules")
+	c, e := content.NewFileContent(defaultRulesPath)
 	if e != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", e)
 		os.Exit(1)
@@ -108,7 +168,7 @@ func main() {
 	} else if *lightFlag {
 		theme = style.LightTheme
 	}
-	w, e := window.NewWindow(c, metainfo, inputs, operations, theme)
+	w, e := window.NewWindow(c, models, canonical_model.DefaultModel, inputs, engine.Operations(), *sampleFlag, maskMode(), theme)
 	if e != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", e)
 		os.Exit(1)
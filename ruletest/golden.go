@@ -0,0 +1,113 @@
+package ruletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"league.com/rulemaker/census"
+	"league.com/rulemaker/engine"
+	"league.com/rulemaker/msg"
+	"league.com/rulemaker/util"
+)
+
+const GoldenExtension = ".golden.json"
+
+func Golden(en *engine.Engine, censusPath, mappingRulesPath, mergingRulesPath, goldenPath string, config msg.M, update bool) ([]string, error) {
+	records, err := census.ReadFile(censusPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := en.IngestFile(filepath.Base(censusPath), records, mappingRulesPath, mergingRulesPath, config); err != nil {
+		return nil, err
+	}
+	got := util.ToJson(en.Hasher().Entries(en.Entries())) + "\n"
+	if update {
+		return nil, ioutil.WriteFile(goldenPath, []byte(got), 0644)
+	}
+
+	expected, err := ioutil.ReadFile(goldenPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s does not exist; run with update to create it", goldenPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var expectedValue, gotValue interface{}
+	if err := json.Unmarshal(expected, &expectedValue); err != nil {
+		return nil, fmt.Errorf("%s: %v", goldenPath, err)
+	}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		return nil, err
+	}
+	var failures []string
+	compareJSON("", expectedValue, gotValue, &failures)
+	return failures, nil
+}
+
+func compareJSON(path string, expected, got interface{}, failures *[]string) {
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		if gotValue, ok := got.(map[string]interface{}); ok {
+			keys := map[string]struct{}{}
+			for key := range expectedValue {
+				keys[key] = struct{}{}
+			}
+			for key := range gotValue {
+				keys[key] = struct{}{}
+			}
+			for _, key := range sortedKeys(keys) {
+				expectedElement, inExpected := expectedValue[key]
+				gotElement, inGot := gotValue[key]
+				switch {
+				case !inGot:
+					*failures = append(*failures, fmt.Sprintf("%s: expected %s, got no value", joinPath(path, key), toJson(expectedElement)))
+				case !inExpected:
+					*failures = append(*failures, fmt.Sprintf("%s: expected no value, got %s", joinPath(path, key), toJson(gotElement)))
+				default:
+					compareJSON(joinPath(path, key), expectedElement, gotElement, failures)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if gotValue, ok := got.([]interface{}); ok && len(gotValue) == len(expectedValue) {
+			for i := range expectedValue {
+				compareJSON(joinPath(path, strconv.Itoa(i)), expectedValue[i], gotValue[i], failures)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(expected, got) {
+		*failures = append(*failures, fmt.Sprintf("%s: expected %s, got %s", path, toJson(expected), toJson(got)))
+	}
+}
+
+func sortedKeys(keys map[string]struct{}) []string {
+	result := make([]string, 0, len(keys))
+	for key := range keys {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func toJson(value interface{}) string {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(bytes)
+}
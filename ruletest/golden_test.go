@@ -0,0 +1,105 @@
+package ruletest
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"league.com/rulemaker/canonical_model"
+	"league.com/rulemaker/engine"
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/msg"
+)
+
+const censusData = `Employee ID,Earnings Amount,Person Type
+1,"$50,000",
+2,1000,X
+1,"$60,000",
+`
+
+func TestGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	censusPath := filepath.Join(dir, "census.csv")
+	rulesPath := filepath.Join(dir, "emp.rules")
+	goldenPath := censusPath + GoldenExtension
+	if err := ioutil.WriteFile(censusPath, []byte(censusData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(rulesPath, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	inputs := model.Set{"employee_id": {}, "earnings_amount": {}, "birth_date": {}, "person_type": {}}
+	run := func(update bool) []string {
+		failures, err := Golden(engine.NewEngine(metainfo, inputs), censusPath, rulesPath, "", goldenPath, msg.M{}, update)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return failures
+	}
+
+	if _, err := Golden(engine.NewEngine(metainfo, inputs), censusPath, rulesPath, "", goldenPath, msg.M{}, false); err == nil {
+		log.Println("expected missing golden file error")
+		t.FailNow()
+	}
+	run(true)
+	if failures := run(false); len(failures) != 0 {
+		log.Println("unexpected failures", failures)
+		t.FailNow()
+	}
+
+	if err := ioutil.WriteFile(rulesPath, []byte(rules+"city = \"Toronto\";\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`1.Entity.city: expected no value, got "Toronto"`,
+		`2.Entity.city: expected no value, got "Toronto"`,
+	}
+	if failures := run(false); !reflect.DeepEqual(failures, expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", failures)
+		t.FailNow()
+	}
+
+	sensitivePath := filepath.Join(dir, "sensitive.csv")
+	if err := ioutil.WriteFile(sensitivePath, []byte("Employee ID,Birth Date\n1,1980-01-02\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	en := engine.NewEngine(metainfo, inputs)
+	en.SetModel(meta.Model{Metainfo: metainfo, IdField: "employee_id", Sensitive: model.Set{"date_of_birth": {}}})
+	if _, err := Golden(en, sensitivePath, rulesPath, "", goldenPath, msg.M{}, true); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(golden), "1980-01-02") || !strings.Contains(string(golden), `"date_of_birth": "sha256:`) {
+		log.Println("expected a hashed golden file, got", string(golden))
+		t.FailNow()
+	}
+
+	if err := ioutil.WriteFile(sensitivePath, []byte("Employee ID,Birth Date\n1,1980-01-03\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	en = engine.NewEngine(metainfo, inputs)
+	en.SetModel(meta.Model{Metainfo: metainfo, IdField: "employee_id", Sensitive: model.Set{"date_of_birth": {}}})
+	failures, err := Golden(en, sensitivePath, rulesPath, "", goldenPath, msg.M{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || !strings.HasPrefix(failures[0], "1.Entity.date_of_birth: expected \"sha256:") || strings.Contains(failures[0], "1980") {
+		log.Println("expected a hashed date of birth difference, got", failures)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,153 @@
+package ruletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"league.com/rulemaker/census"
+	"league.com/rulemaker/diff"
+	"league.com/rulemaker/engine"
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/msg"
+)
+
+const Extension = ".test"
+
+type Case struct {
+	Name     string         `json:"name"`
+	Input    msg.M          `json:"input"`
+	Expected msg.M          `json:"expected"`
+	Actions  []model.Action `json:"actions"`
+}
+
+type Result struct {
+	Name     string
+	Failures []string
+}
+
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+func (r Result) String() string {
+	if r.Passed() {
+		return fmt.Sprintf("PASS %s", r.Name)
+	}
+	buf := strings.Builder{}
+	fmt.Fprintf(&buf, "FAIL %s", r.Name)
+	for _, failure := range r.Failures {
+		fmt.Fprintf(&buf, "\n    %s", failure)
+	}
+	return buf.String()
+}
+
+func ReadFile(path string) ([]Case, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	if err := json.Unmarshal(bytes, &cases); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i := range cases {
+		if cases[i].Name == "" {
+			cases[i].Name = fmt.Sprintf("case %d", i+1)
+		}
+	}
+	return cases, nil
+}
+
+func Run(en *engine.Engine, rulesPath, testPath string, cases []Case, config msg.M) ([]Result, error) {
+	records := make(model.Records, len(cases))
+	for i, c := range cases {
+		records[i] = record{line: i + 1, fields: c.Input}
+	}
+	entries, err := en.MapRecords(testPath, records, rulesPath, config)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(cases))
+	for i, c := range cases {
+		results[i] = Result{Name: c.Name, Failures: check(en.Metainfo(), c, entries[i])}
+	}
+	return results, nil
+}
+
+func check(metainfo meta.Meta, c Case, entry *model.Entry) (failures []string) {
+	expected := metainfo.Restore(c.Expected)
+	for _, change := range diff.Compare(metainfo, expected, entry.Entity) {
+		field := meta.SplitPath(change.Field)[0]
+		if _, ok := c.Expected[field]; !ok {
+			continue
+		}
+		switch change.Kind {
+		case diff.Added:
+			failures = append(failures, fmt.Sprintf("%s: expected no value, got %s", change.Field, format(change.NewValue)))
+		case diff.Removed:
+			failures = append(failures, fmt.Sprintf("%s: expected %s, got no value", change.Field, format(change.OldValue)))
+		case diff.Modified:
+			failures = append(failures, fmt.Sprintf("%s: expected %s, got %s", change.Field, format(change.OldValue), format(change.NewValue)))
+		}
+	}
+
+	expectedActions := actions(c.Actions)
+	var gotActions []model.Action
+	for _, d := range entry.Diagnostics {
+		gotActions = append(gotActions, d.Action)
+	}
+	gotActions = actions(gotActions)
+	if fmt.Sprint(expectedActions) != fmt.Sprint(gotActions) {
+		failures = append(failures, fmt.Sprintf("actions: expected %v, got %v", expectedActions, gotActions))
+		for _, d := range entry.Diagnostics {
+			if d.Action != model.Log {
+				failures = append(failures, fmt.Sprintf("    %s %s: %s", d.Action, d.Field, d.Message))
+			}
+		}
+	}
+	return failures
+}
+
+func format(value interface{}) string {
+	if date, ok := value.(time.Time); ok {
+		return date.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func actions(in []model.Action) []model.Action {
+	result := []model.Action{}
+	for _, action := range in {
+		if action != model.Log && action != model.None {
+			result = append(result, action)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+type record struct {
+	line   int
+	fields msg.M
+}
+
+func (r record) Line() int {
+	return r.line
+}
+
+func (r record) Field(name, kind string) (interface{}, error) {
+	switch value := r.fields[name].(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		return census.ConvertInput(name, kind, strconv.FormatFloat(value, 'f', -1, 64), meta.Formats{})
+	default:
+		return census.ConvertInput(name, kind, fmt.Sprint(value), meta.Formats{})
+	}
+}
@@ -0,0 +1,78 @@
+package ruletest
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"league.com/rulemaker/canonical_model"
+	"league.com/rulemaker/engine"
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/msg"
+)
+
+const rules = `
+employee_id = $employee_id;
+annual_earnings = $earnings_amount:float;
+date_of_birth = $birth_date:date;
+_check = (map $person_type X: (ticket "unusual person type"));
+`
+
+const cases = `[
+    {
+        "name": "passes",
+        "input": {"employee_id": "1", "earnings_amount": "$50,000", "birth_date": "1980-01-02", "person_type": "X"},
+        "expected": {"employee_id": "1", "annual_earnings": 50000, "date_of_birth": "1980-01-02", "city": null},
+        "actions": ["ticket"]
+    },
+    {
+        "input": {"employee_id": "2", "earnings_amount": 1000, "person_type": "X"},
+        "expected": {"annual_earnings": 2000, "date_of_birth": "1980-01-02"}
+    }
+]`
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ruletest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rulesPath := filepath.Join(dir, "emp.rules")
+	testPath := rulesPath + Extension
+	if err := ioutil.WriteFile(rulesPath, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(testPath, []byte(cases), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases, err := ReadFile(testPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+	inputs := model.Set{"employee_id": {}, "earnings_amount": {}, "birth_date": {}, "person_type": {}}
+	results, err := Run(engine.NewEngine(metainfo, inputs), rulesPath, testPath, testCases, msg.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Result{
+		{Name: "passes"},
+		{Name: "case 2", Failures: []string{
+			"annual_earnings: expected 2000.00, got 1000.00",
+			"date_of_birth: expected 1980-01-02, got no value",
+			"actions: expected [], got [ticket]",
+			"    ticket _check: unusual person type",
+		}},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		log.Println("expected", expected)
+		log.Println("got     ", results)
+		t.FailNow()
+	}
+}
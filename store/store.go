@@ -0,0 +1,138 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+)
+
+type Reader interface {
+	Entry(id string) *model.Entry
+	Entries() model.Entries
+	EntriesAt(version int) model.Entries
+	Version() int
+}
+
+type Store interface {
+	Reader
+	Save(entries model.Entries) (version int, err error)
+}
+
+type record struct {
+	Version int          `json:"version"`
+	Time    time.Time    `json:"time"`
+	Id      string       `json:"id,omitempty"`
+	Entry   *model.Entry `json:"entry,omitempty"`
+}
+
+type FileStore struct {
+	path     string
+	versions []model.Entries
+}
+
+func Open(path string, metainfo meta.Meta) (*FileStore, error) {
+	s := &FileStore{path: path}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		r := record{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if r.Version < 1 || r.Id != "" && r.Entry == nil {
+			return nil, fmt.Errorf("%s:%d: invalid record", path, line)
+		}
+		for len(s.versions) < r.Version {
+			s.versions = append(s.versions, model.Entries{})
+		}
+		if r.Id == "" {
+			continue
+		}
+		r.Entry.Entity = metainfo.Restore(r.Entry.Entity)
+		s.versions[r.Version-1][r.Id] = r.Entry
+	}
+	return s, scanner.Err()
+}
+
+func (s *FileStore) Version() int {
+	return len(s.versions)
+}
+
+func (s *FileStore) Entry(id string) *model.Entry {
+	if len(s.versions) == 0 {
+		return nil
+	}
+	return s.versions[len(s.versions)-1][id]
+}
+
+func (s *FileStore) Entries() model.Entries {
+	return s.EntriesAt(s.Version())
+}
+
+func (s *FileStore) EntriesAt(version int) model.Entries {
+	result := model.Entries{}
+	if version < 1 || version > len(s.versions) {
+		return result
+	}
+	for id, entry := range s.versions[version-1] {
+		result[id] = entry
+	}
+	return result
+}
+
+func (s *FileStore) Save(entries model.Entries) (version int, err error) {
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	version = len(s.versions) + 1
+	now := time.Now().UTC()
+	ids := make([]string, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(record{Version: version, Time: now}); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := encoder.Encode(record{Version: version, Time: now, Id: id, Entry: entries[id]}); err != nil {
+			return 0, err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+	saved := model.Entries{}
+	for id, entry := range entries {
+		saved[id] = entry
+	}
+	s.versions = append(s.versions, saved)
+	return version, nil
+}
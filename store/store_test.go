@@ -0,0 +1,86 @@
+package store
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"league.com/rulemaker/canonical_model"
+	"league.com/rulemaker/meta"
+	"league.com/rulemaker/model"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entries.log")
+	metainfo := meta.Metainfo(canonical_model.EmployeeDTO{})
+
+	s, err := Open(path, metainfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := model.Entries{
+		"1": {Entity: model.Entity{"employee_id": "1", "city": "Toronto"}, Sources: model.Sources{{FilePath: "a.csv", LineNumber: 2}}},
+		"2": {Entity: model.Entity{"employee_id": "2", "date_of_birth": time.Date(1980, 1, 2, 0, 0, 0, 0, time.UTC)}},
+	}
+	second := model.Entries{
+		"1": {Entity: model.Entity{"employee_id": "1", "city": "Ottawa", "dependents": []model.Entity{{"first_name": "Ann"}}}},
+	}
+	if version, err := s.Save(first); err != nil || version != 1 {
+		t.Fatal(version, err)
+	}
+	if version, err := s.Save(second); err != nil || version != 2 {
+		t.Fatal(version, err)
+	}
+
+	s, err = Open(path, metainfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version() != 2 {
+		log.Println("expected version 2, got", s.Version())
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(s.Entry("1"), second["1"]) {
+		log.Println("expected", second["1"])
+		log.Println("got     ", s.Entry("1"))
+		t.FailNow()
+	}
+	if s.Entry("2") != nil {
+		log.Println("entry removed from the latest snapshot:", s.Entry("2"))
+		t.FailNow()
+	}
+	if s.Entry("3") != nil {
+		log.Println("unexpected entry", s.Entry("3"))
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(s.EntriesAt(1), first) {
+		log.Println("expected", first)
+		log.Println("got     ", s.EntriesAt(1))
+		t.FailNow()
+	}
+	if entries := s.Entries(); len(entries) != 1 || entries["1"] != s.Entry("1") {
+		log.Println("unexpected entries", entries)
+		t.FailNow()
+	}
+
+	if version, err := s.Save(model.Entries{}); err != nil || version != 3 {
+		t.Fatal(version, err)
+	}
+	s, err = Open(path, metainfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version() != 3 || len(s.Entries()) != 0 || len(s.EntriesAt(2)) != 1 {
+		log.Println("expected an empty third snapshot, got", s.Version(), s.Entries())
+		t.FailNow()
+	}
+}
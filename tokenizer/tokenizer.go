@@ -30,6 +30,37 @@ func TokenizeRunes(content [][]rune) Tokens {
 type Tokens []Token
 
 func (t Tokens) Text(token Token) string {
+	switch token.Type() {
+	case CanonicalField, Operation, Variable, Label:
+		text, _ := token.Value().(string)
+		return text
+	case Input:
+		return fmt.Sprintf("$%v", token.Value())
+	case StringLiteral:
+		return strconv.Quote(token.Value().(string))
+	case IntegerLiteral, RealLiteral, BooleanLiteral:
+		return fmt.Sprint(token.Value())
+	case NilLiteral:
+		return "nil"
+	case DateLiteral:
+		return "@" + token.Value().(time.Time).Format("2006-01-02")
+	case DaySpanLiteral:
+		return fmt.Sprintf("%dd", token.Value())
+	case MonthSpanLiteral:
+		return fmt.Sprintf("%dm", token.Value())
+	case YearSpanLiteral:
+		return fmt.Sprintf("%dy", token.Value())
+	case TodayLiteral:
+		return "today"
+	case EqualSign:
+		return "="
+	case Semicolon:
+		return ";"
+	case OpenParenthesis:
+		return "("
+	case CloseParenthesis:
+		return ")"
+	}
 	return ""
 }
 
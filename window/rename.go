@@ -0,0 +1,68 @@
+package window
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell"
+	"league.com/rulemaker/model"
+)
+
+const renameMenu = "(Esc) Cancel  (Enter) Rename"
+
+type renameState struct {
+	symbol string
+	name   []rune
+	origin model.Cursor
+}
+
+func (w *window) openRename() {
+	token, ok := w.parser.Symbol(w.content.Cursor.Line, w.content.Cursor.Column)
+	if !ok {
+		w.message = "nothing to rename here"
+		return
+	}
+	symbol := w.tokens.Text(token)
+	w.rename = &renameState{
+		symbol: symbol,
+		name:   []rune(symbol),
+		origin: model.Cursor{Line: token.Line(), Column: token.StartColumn()},
+	}
+}
+
+func (w *window) handleRenameKey(ev *tcell.EventKey) {
+	r := w.rename
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		w.rename = nil
+	case tcell.KeyRune:
+		r.name = append(r.name, ev.Rune())
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(r.name) > 0 {
+			r.name = r.name[:len(r.name)-1]
+		}
+	case tcell.KeyEnter:
+		edits, e := w.parser.Rename(r.origin.Line, r.origin.Column, string(r.name))
+		if e != nil {
+			w.message = e.Error()
+			return
+		}
+		for i := len(edits) - 1; i >= 0; i-- {
+			edit := edits[i]
+			w.content.Replace(edit.Token.Line(), edit.Token.StartColumn(), edit.Token.EndColumn(), []rune(edit.Text))
+		}
+		w.content.SetCursor(r.origin.Line, r.origin.Column)
+		w.message = fmt.Sprintf("renamed %d references to %s", len(edits), r.symbol)
+		w.rename = nil
+	}
+}
+
+func (w *window) showRename() {
+	prompt := fmt.Sprintf("Rename %s to: ", w.rename.symbol)
+	input := prompt + string(w.rename.name)
+	status := input
+	if w.message != "" {
+		status += "  " + w.message
+	}
+	w.setText(status, w.height-1, 1, menuStyle)
+	w.screen.ShowCursor(1+len([]rune(input)), w.height-1)
+}
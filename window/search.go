@@ -0,0 +1,188 @@
+package window
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell"
+	"league.com/rulemaker/content"
+	"league.com/rulemaker/model"
+	"league.com/rulemaker/tokenizer"
+)
+
+const searchMenu = "(Esc) Close  (Enter) Next/Replace  (Up/Down) Previous/Next  (Tab) Find/Replace  (Ctrl-R) Regex  (Ctrl-G) Case  (Ctrl-T) Token  (Ctrl-A) Replace All"
+
+var searchTokenTypes = []tokenizer.TokenType{
+	tokenizer.InvalidToken,
+	tokenizer.Input,
+	tokenizer.Variable,
+	tokenizer.CanonicalField,
+	tokenizer.StringLiteral,
+	tokenizer.Comment,
+}
+
+type searchState struct {
+	content.Search
+	query       []rune
+	replacement []rune
+	replacing   bool
+	origin      model.Cursor
+	matches     content.Matches
+	byLine      map[int]content.Matches
+	err         error
+}
+
+func (w *window) openSearch() {
+	if w.search == nil {
+		w.search = &searchState{origin: w.content.Cursor}
+	}
+	w.search.replacing = false
+}
+
+func (w *window) findMatches() {
+	if w.search == nil {
+		return
+	}
+	w.search.matches = w.search.Find(w.content, w.tokens)
+	w.search.byLine = map[int]content.Matches{}
+	for _, match := range w.search.matches {
+		w.search.byLine[match.Line] = append(w.search.byLine[match.Line], match)
+	}
+}
+
+func (w *window) updateSearch() {
+	w.search.Pattern = string(w.search.query)
+	w.search.err = w.search.Compile()
+	w.findMatches()
+	if match, ok := w.search.matches.Next(w.search.origin, true); ok {
+		w.content.SetCursor(match.Line, match.Start)
+	}
+}
+
+func (w *window) handleSearchKey(ev *tcell.EventKey) {
+	s := w.search
+	field := &s.query
+	if s.replacing {
+		field = &s.replacement
+	}
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		w.search = nil
+	case tcell.KeyCtrlF:
+		s.replacing = false
+	case tcell.KeyTab:
+		s.replacing = !s.replacing
+	case tcell.KeyRune:
+		*field = append(*field, ev.Rune())
+		if !s.replacing {
+			w.updateSearch()
+		}
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(*field) > 0 {
+			*field = (*field)[:len(*field)-1]
+		}
+		if !s.replacing {
+			w.updateSearch()
+		}
+	case tcell.KeyCtrlR:
+		s.Regex = !s.Regex
+		w.updateSearch()
+	case tcell.KeyCtrlG:
+		s.CaseSensitive = !s.CaseSensitive
+		w.updateSearch()
+	case tcell.KeyCtrlT:
+		for i, tokenType := range searchTokenTypes {
+			if tokenType == s.TokenType {
+				s.TokenType = searchTokenTypes[(i+1)%len(searchTokenTypes)]
+				break
+			}
+		}
+		w.updateSearch()
+	case tcell.KeyEnter:
+		if s.replacing {
+			w.replaceCurrent()
+		} else {
+			w.nextMatch()
+		}
+	case tcell.KeyDown:
+		w.nextMatch()
+	case tcell.KeyUp:
+		if match, ok := s.matches.Previous(w.content.Cursor); ok {
+			w.content.SetCursor(match.Line, match.Start)
+		}
+	case tcell.KeyCtrlA:
+		count := len(s.matches)
+		s.Replace(w.content, s.matches, string(s.replacement))
+		w.message = fmt.Sprintf("replaced %d", count)
+		w.tokens = tokenizer.TokenizeRunes(w.content.Runes)
+		w.findMatches()
+	}
+}
+
+func (w *window) nextMatch() {
+	if match, ok := w.search.matches.Next(w.content.Cursor, false); ok {
+		w.content.SetCursor(match.Line, match.Start)
+	}
+}
+
+func (w *window) replaceCurrent() {
+	s := w.search
+	i, ok := s.matches.At(w.content.Cursor)
+	if !ok {
+		w.nextMatch()
+		return
+	}
+	s.Replace(w.content, s.matches[i:i+1], string(s.replacement))
+	w.tokens = tokenizer.TokenizeRunes(w.content.Runes)
+	w.findMatches()
+	if match, ok := s.matches.Next(w.content.Cursor, true); ok {
+		w.content.SetCursor(match.Line, match.Start)
+	}
+}
+
+func (w *window) searchStyle(cursor model.Cursor, style tcell.Style) tcell.Style {
+	if w.search == nil {
+		return style
+	}
+	for _, match := range w.search.byLine[cursor.Line] {
+		if match.Start <= cursor.Column && cursor.Column < match.End {
+			if match.Line == w.content.Cursor.Line && match.Start == w.content.Cursor.Column {
+				return style.Background(tcell.ColorYellow).Foreground(tcell.ColorBlack)
+			}
+			return style.Reverse(true)
+		}
+	}
+	return style
+}
+
+func (w *window) showSearch() {
+	s := w.search
+	options := ""
+	if s.Regex {
+		options += " [regex]"
+	}
+	if s.CaseSensitive {
+		options += " [case]"
+	}
+	if s.TokenType != tokenizer.InvalidToken {
+		options += fmt.Sprintf(" [%s]", s.TokenType)
+	}
+	result := fmt.Sprintf("%d matches", len(s.matches))
+	if i, ok := s.matches.At(w.content.Cursor); ok {
+		result = fmt.Sprintf("%d of %d", i+1, len(s.matches))
+	}
+	if s.err != nil {
+		result = s.err.Error()
+	}
+	find := fmt.Sprintf("Find: %s", string(s.query))
+	replace := fmt.Sprintf("  Replace: %s", string(s.replacement))
+	status := find + replace + options + "  " + result
+	if w.message != "" {
+		status += "  " + w.message
+	}
+	w.setText(status, w.height-1, 1, menuStyle)
+	column := 1 + len([]rune(find))
+	if s.replacing {
+		column += len([]rune(replace))
+	}
+	w.screen.ShowCursor(column, w.height-1)
+}
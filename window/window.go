@@ -1,13 +1,20 @@
 package window
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gdamore/tcell"
+	"league.com/rulemaker/census"
 	"league.com/rulemaker/content"
+	"league.com/rulemaker/engine"
 	"league.com/rulemaker/meta"
 	"league.com/rulemaker/model"
+	"league.com/rulemaker/msg"
 	"league.com/rulemaker/parser"
 	"league.com/rulemaker/style"
 	"league.com/rulemaker/tokenizer"
@@ -18,7 +25,16 @@ type Window interface {
 	Run()
 }
 
-func NewWindow(c *content.Content, metainfo meta.Meta, inputs, operations model.Set, theme style.Theme) (Window, error) {
+func NewWindow(c *content.Content, models meta.Models, defaultModel string, inputs, operations model.Set, samplePath string, maskMode meta.MaskMode, theme style.Theme) (Window, error) {
+	var samples model.Records
+	if samplePath != "" {
+		var e error
+		samples, e = census.ReadFile(samplePath)
+		if e != nil {
+			return nil, e
+		}
+	}
+
 	if theme == style.BlueTheme {
 		mainStyle = tcell.StyleDefault.Foreground(tcell.Color231).Background(tcell.Color17)
 		lineNumberStyle = mainStyle.Foreground(tcell.ColorSilver).Background(tcell.Color18)
@@ -48,10 +64,17 @@ func NewWindow(c *content.Content, metainfo meta.Meta, inputs, operations model.
 	screen.Clear()
 
 	w := &window{
-		theme:   theme,
-		content: c,
-		parser:  parser.NewParser(metainfo, inputs, operations),
-		screen:  screen,
+		theme:          theme,
+		content:        c,
+		models:         models,
+		defaultModel:   defaultModel,
+		maskMode:       maskMode,
+		inputs:         inputs,
+		operations:     operations,
+		samplePath:     samplePath,
+		samples:        samples,
+		sampleWarnings: census.DateAmbiguities(samples),
+		screen:         screen,
 	}
 
 	w.titleView = view.NewView(mainStyle)
@@ -60,7 +83,9 @@ func NewWindow(c *content.Content, metainfo meta.Meta, inputs, operations model.
 	w.mainView = view.NewView(mainStyle)
 	w.diagnosticsView = view.NewView(mainStyle)
 	w.completionsView = view.NewView(mainStyle)
+	w.previewView = view.NewView(mainStyle)
 	w.statusView = view.NewView(menuStyle)
+	w.selectModel()
 
 	return w, nil
 }
@@ -75,8 +100,25 @@ var (
 type window struct {
 	theme   style.Theme
 	content *content.Content
+	message string
+	search  *searchState
+	rename  *renameState
+
+	models       meta.Models
+	defaultModel string
+	modelName    string
+	unknownModel bool
+	maskMode     meta.MaskMode
+	inputs       model.Set
+	operations   model.Set
 
 	parser *parser.Parser
+	engine *engine.Engine
+
+	samplePath     string
+	samples        model.Records
+	sampleWarnings []string
+	sampleIndex    int
 
 	screen         tcell.Screen
 	width, height  int
@@ -88,10 +130,12 @@ type window struct {
 	lineNumberView  *view.View
 	diagnosticsView *view.View
 	completionsView *view.View
+	previewView     *view.View
 	statusView      *view.View
 
 	tokens                  tokenizer.Tokens
 	diagnosticsViewPointers []point
+	previewLines            []previewLine
 
 	buttons        tcell.ButtonMask
 	startSelection bool
@@ -102,6 +146,12 @@ type point struct {
 	line, column int
 }
 
+type previewLine struct {
+	text   string
+	rule   point
+	linked bool
+}
+
 func (w *window) resize() {
 	w.width, w.height = w.screen.Size()
 	w.vSplit = w.width - 64
@@ -121,7 +171,13 @@ func (w *window) resize() {
 	w.lineNumberView.Resize(2, w.height-1, 0, lineNumberViewWidth)
 	w.mainView.Resize(2, w.height-1, lineNumberViewWidth, w.vSplit)
 	w.diagnosticsView.Resize(w.hSplit+1, w.height-1, w.vSplit+1, w.width)
-	w.completionsView.Resize(2, w.hSplit, w.vSplit+1, w.width)
+	if len(w.samples) > 0 {
+		w.previewView.Resize(2, w.hSplit, w.vSplit+1, w.width)
+		w.completionsView.Resize(2, 2, w.vSplit+1, w.width)
+	} else {
+		w.previewView.Resize(2, 2, w.vSplit+1, w.width)
+		w.completionsView.Resize(2, w.hSplit, w.vSplit+1, w.width)
+	}
 	w.statusView.Resize(w.height-1, w.height, 0, w.width)
 }
 
@@ -133,6 +189,7 @@ func (w *window) clear() {
 	w.Clear(w.mainView)
 	w.Clear(w.diagnosticsView)
 	w.Clear(w.completionsView)
+	w.Clear(w.previewView)
 	w.Clear(w.statusView)
 
 	for row := 2; row < w.height-1; row++ {
@@ -145,22 +202,69 @@ func (w *window) clear() {
 	}
 
 	w.setText("Rule Maker", 0, 1, mainStyle.Bold(true))
+	if w.unknownModel {
+		w.setText(fmt.Sprintf("unknown model '%s', using %s", w.modelName, w.defaultModel), 0, 13, mainStyle.Foreground(tcell.ColorRed))
+	} else {
+		w.setText(fmt.Sprintf("model: %s", w.modelName), 0, 13, mainStyle)
+	}
 	w.setText(time.Now().Format("2006-01-02"), 0, w.width-11, mainStyle.Bold(true))
-	w.setText("(Ctrl-Q) Quit  (Ctrl-N) Next Error  (Ctrl-P) Previous error", 1, 1, menuStyle)
+	menu := "(Ctrl-Q) Quit  (Ctrl-S) Save  (Ctrl-F) Find  (F2) Rename  (Ctrl-N) Next Error  (Ctrl-P) Previous error  (F4) Apply Fix"
+	if len(w.samples) > 0 {
+		menu += "  (F5) Previous Record  (F6) Next Record"
+	}
+	if w.search != nil {
+		menu = searchMenu
+	}
+	if w.rename != nil {
+		menu = renameMenu
+	}
+	w.setText(menu, 1, 1, menuStyle)
 }
 
 func (w *window) draw() {
+	w.selectModel()
 	w.clear()
 	w.tokens = tokenizer.TokenizeRunes(w.content.Runes)
 	w.parser.Parse(w.tokens)
+	w.findMatches()
+	w.runSample()
 	w.showText()
 	w.showLineNumbers()
-	// w.showDiagnostics()
+	w.showDiagnostics()
 	// w.showCompletions()
+	w.showPreview()
 	w.showStatus()
 	w.screen.Show()
 }
 
+func (w *window) selectModel() {
+	lines := make([]string, len(w.content.Runes))
+	for i, line := range w.content.Runes {
+		lines[i] = string(line)
+	}
+	name, _ := parser.ModelDirective(strings.Join(lines, "\n"))
+	if name == "" {
+		name = w.defaultModel
+	}
+	if w.parser != nil && name == w.modelName {
+		return
+	}
+	w.modelName = name
+	m, ok := w.models[name]
+	w.unknownModel = !ok
+	if !ok {
+		m = w.models[w.defaultModel]
+	}
+	w.parser = parser.NewParser(m.Metainfo, w.inputs, w.operations)
+	w.parser.SetRequired(m.Required)
+	w.parser.SetDeclared(census.Columns(w.samples))
+	w.parser.SetPredefined(engine.Variables())
+	w.parser.SetSignatures(engine.Signatures())
+	w.engine = engine.NewEngine(m.Metainfo, w.inputs)
+	w.engine.SetModel(m)
+	w.engine.SetMaskMode(w.maskMode)
+}
+
 func (w *window) setText(text string, line, column int, style tcell.Style) {
 	for i, ch := range text {
 		w.screen.SetContent(column+i, line, ch, nil, style)
@@ -186,7 +290,7 @@ func (s *mainViewStream) Rune(ch rune, contentCursor, screenCursor model.Cursor)
 		}
 		token = s.window.tokens[s.currentTokenIndex]
 	}
-	runeStyle := style.TokenStyle(token.Type(), s.window.theme)
+	runeStyle := s.window.searchStyle(contentCursor, style.TokenStyle(token.Type(), s.window.theme))
 	s.window.screen.SetContent(screenCursor.Column, screenCursor.Line, ch, nil, runeStyle)
 }
 
@@ -250,16 +354,160 @@ func (w *window) showDiagnostics() {
 	reportLine := 0
 	w.diagnosticsViewPointers = []point{}
 	for _, d := range w.parser.Diagnostics() {
-		message := fmt.Sprintf("%d:%d %s", d.Token.Line()+1, d.Token.StartColumn()+1, d.Message)
+		message := fmt.Sprintf("%d:%d %s %s", d.Token.Line()+1, d.Token.StartColumn()+1, d.Code, d.Message)
+		diagnosticStyle := mainStyle
+		if d.Severity != parser.Error {
+			message = fmt.Sprintf("%d:%d %s %s: %s", d.Token.Line()+1, d.Token.StartColumn()+1, d.Code, d.Severity, d.Message)
+			diagnosticStyle = mainStyle.Dim(true)
+		}
 		lines := wrapLines(message, w.diagnosticsView.Width)
 		for _, line := range lines {
-			w.setText(line, reportLine, 0, mainStyle)
+			w.setViewText(w.diagnosticsView, line, reportLine, diagnosticStyle)
 			w.diagnosticsViewPointers = append(w.diagnosticsViewPointers, point{d.Token.Line(), d.Token.StartColumn()})
 			reportLine++
 		}
 	}
 }
 
+func (w *window) applyFix() {
+	var fix *parser.Edit
+	for _, d := range w.parser.Diagnostics() {
+		if len(d.Edits) == 0 || d.Token.Line() != w.content.Cursor.Line {
+			continue
+		}
+		if fix == nil || d.Token.StartColumn() <= w.content.Cursor.Column && w.content.Cursor.Column <= d.Token.EndColumn() {
+			fix = &d.Edits[0]
+		}
+	}
+	if fix != nil {
+		w.content.Replace(fix.Token.Line(), fix.Token.StartColumn(), fix.Token.EndColumn(), []rune(fix.Text))
+	}
+}
+
+func (w *window) setViewText(v *view.View, text string, line int, style tcell.Style) {
+	screenLine := line - v.LineOffset
+	if screenLine < 0 || screenLine >= v.Height {
+		return
+	}
+	runes := []rune(text)
+	if len(runes) > v.Width {
+		runes = runes[:v.Width]
+	}
+	w.setText(string(runes), v.Top+screenLine, v.Left, style)
+}
+
+func (w *window) runSample() {
+	w.previewLines = nil
+	if len(w.samples) == 0 {
+		return
+	}
+	if w.sampleIndex >= len(w.samples) {
+		w.sampleIndex = len(w.samples) - 1
+	}
+	record := w.samples[w.sampleIndex]
+	entry, trace := w.engine.DryRun(w.tokens, w.parser.OrderedRules(), w.samplePath, record, msg.M{})
+	w.previewLines = append(w.previewLines, previewLine{
+		text: fmt.Sprintf("Record %d of %d (line %d)", w.sampleIndex+1, len(w.samples), record.Line()),
+	})
+	for _, ambiguity := range w.sampleWarnings {
+		w.previewLines = append(w.previewLines, previewLine{text: "warning: " + ambiguity})
+	}
+	w.previewLines = append(w.previewLines, jsonLines("", w.engine.Masker().Entity(entry.Entity), "", 0, "", trace)...)
+	for _, d := range entry.Diagnostics {
+		line := previewLine{text: fmt.Sprintf("%s %s: %s", d.Action, d.Field, d.Message)}
+		if token, ok := trace.Rule(d.Field); ok {
+			line.rule, line.linked = point{token.Line(), token.StartColumn()}, true
+		} else if token, ok := w.ruleToken(d.Field); ok {
+			line.rule, line.linked = point{token.Line(), token.StartColumn()}, true
+		}
+		w.previewLines = append(w.previewLines, line)
+	}
+}
+
+func (w *window) ruleToken(field string) (tokenizer.Token, bool) {
+	for _, rule := range w.parser.Rules() {
+		if rule.Field >= 0 && w.tokens.Text(w.tokens[rule.Field]) == field {
+			return w.tokens[rule.Field], true
+		}
+	}
+	return tokenizer.Token{}, false
+}
+
+func jsonLines(key string, value interface{}, path string, indent int, comma string, trace engine.Trace) (result []previewLine) {
+	prefix := strings.Repeat("  ", indent)
+	if key != "" {
+		prefix += strconv.Quote(key) + ": "
+	}
+	first := previewLine{}
+	if token, ok := trace.Rule(path); ok && path != "" {
+		first.rule, first.linked = point{token.Line(), token.StartColumn()}, true
+	}
+	closing := previewLine{text: strings.Repeat("  ", indent)}
+	switch value := value.(type) {
+	case model.Entity:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		first.text = prefix + "{"
+		result = append(result, first)
+		for i, key := range keys {
+			result = append(result, jsonLines(key, value[key], joinPath(path, key), indent+1, separator(i, len(keys)), trace)...)
+		}
+		closing.text += "}" + comma
+		return append(result, closing)
+	case []model.Entity:
+		first.text = prefix + "["
+		result = append(result, first)
+		for i, element := range value {
+			result = append(result, jsonLines("", element, joinPath(path, strconv.Itoa(i)), indent+1, separator(i, len(value)), trace)...)
+		}
+		closing.text += "]" + comma
+		return append(result, closing)
+	case []interface{}:
+		first.text = prefix + "["
+		result = append(result, first)
+		for i, element := range value {
+			result = append(result, jsonLines("", element, joinPath(path, strconv.Itoa(i)), indent+1, separator(i, len(value)), trace)...)
+		}
+		closing.text += "]" + comma
+		return append(result, closing)
+	}
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		bytes = []byte(fmt.Sprintf("%q", fmt.Sprint(value)))
+	}
+	first.text = prefix + string(bytes) + comma
+	return append(result, first)
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func separator(index, length int) string {
+	if index < length-1 {
+		return ","
+	}
+	return ""
+}
+
+func (w *window) showPreview() {
+	for i, line := range w.previewLines {
+		lineStyle := mainStyle
+		if line.linked {
+			lineStyle = style.TokenStyle(tokenizer.CanonicalField, w.theme)
+		} else if i == 0 {
+			lineStyle = mainStyle.Bold(true)
+		}
+		w.setViewText(w.previewView, line.text, i, lineStyle)
+	}
+}
+
 func (w *window) showCompletions() {
 	complitions := w.parser.Completions(w.content.Cursor.Line, w.content.Cursor.Column)
 	for i, complition := range complitions {
@@ -286,7 +534,19 @@ func wrapLines(str string, w int) (result []string) {
 }
 
 func (w *window) showStatus() {
-	w.setText(fmt.Sprintf("%s %d:%d", w.content.Path, w.content.Cursor.Line+1, w.content.Cursor.Column+1), w.height-1, 1, menuStyle)
+	if w.rename != nil {
+		w.showRename()
+		return
+	}
+	if w.search != nil {
+		w.showSearch()
+		return
+	}
+	status := fmt.Sprintf("%s %d:%d", w.content.Path, w.content.Cursor.Line+1, w.content.Cursor.Column+1)
+	if w.message != "" {
+		status += "  " + w.message
+	}
+	w.setText(status, w.height-1, 1, menuStyle)
 }
 
 func (w *window) Run() {
@@ -307,7 +567,16 @@ func (w *window) handleEvent() bool {
 	case *tcell.EventResize:
 		w.screen.Sync()
 	case *tcell.EventKey:
-		if ev.Key() == tcell.KeyRune {
+		w.message = ""
+		if w.rename != nil && ev.Key() != tcell.KeyCtrlQ {
+			w.handleRenameKey(ev)
+		} else if w.search != nil && ev.Key() != tcell.KeyCtrlQ && ev.Key() != tcell.KeyCtrlS {
+			w.handleSearchKey(ev)
+		} else if ev.Key() == tcell.KeyF2 {
+			w.openRename()
+		} else if ev.Key() == tcell.KeyCtrlF {
+			w.openSearch()
+		} else if ev.Key() == tcell.KeyRune {
 			w.content.InsertRune(ev.Rune())
 			if ev.Rune() == '(' {
 				w.content.InsertRune(')')
@@ -360,9 +629,27 @@ func (w *window) handleEvent() bool {
 					break
 				}
 			}
+		} else if ev.Key() == tcell.KeyF4 {
+			w.applyFix()
+		} else if ev.Key() == tcell.KeyF5 {
+			if w.sampleIndex > 0 {
+				w.sampleIndex--
+			}
+			w.previewView.LineOffset = 0
+		} else if ev.Key() == tcell.KeyF6 {
+			if w.sampleIndex < len(w.samples)-1 {
+				w.sampleIndex++
+			}
+			w.previewView.LineOffset = 0
 		} else if ev.Key() == tcell.KeyTab {
 			text := w.parser.Completion(0)
 			w.content.InsertRunes([]rune(text))
+		} else if ev.Key() == tcell.KeyCtrlS {
+			if e := w.content.Save(); e != nil {
+				w.message = fmt.Sprintf("save failed: %v", e)
+			} else {
+				w.message = "saved"
+			}
 		} else if ev.Key() == tcell.KeyCtrlQ {
 			w.screen.Fini()
 			return false
@@ -401,6 +688,13 @@ func (w *window) handleEvent() bool {
 						w.content.SetCursor(p.line, p.column)
 					}
 				})
+			} else if w.previewView.Contains(y, x) {
+				w.previewView.ForCursor(y, x, func(line, column int) {
+					if line < len(w.previewLines) && w.previewLines[line].linked {
+						p := w.previewLines[line].rule
+						w.content.SetCursor(p.line, p.column)
+					}
+				})
 			} else if w.completionsView.Contains(y, x) {
 				w.lineNumberView.ForCursor(y, x, func(line, _ int) {
 					text := w.parser.Completion(line)
@@ -428,6 +722,8 @@ func (w *window) handleEvent() bool {
 				w.completionsView.Scroll(lines, w.parser.TotalCompletions()-1)
 			} else if w.diagnosticsView.Contains(y, x) {
 				w.diagnosticsView.Scroll(lines, len(w.diagnosticsViewPointers)-1)
+			} else if w.previewView.Contains(y, x) {
+				w.previewView.Scroll(lines, len(w.previewLines)-1)
 			}
 			w.showCursor()
 		}